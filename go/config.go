@@ -0,0 +1,544 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"loadtester_go/loadtest"
+)
+
+var defaultPercentiles = loadtest.DefaultConfig().Percentiles
+
+// knownSettings collects the environment variables read by parseConfig, so
+// that misspelt keys in a CONFIG_FILE can be reported. Every setting is read
+// through lookupSetting or the helpers below, which record its name.
+var knownSettings = map[string]bool{"CONFIG_FILE": true}
+
+func lookupSetting(key string) (string, bool) {
+	knownSettings[key] = true
+	return os.LookupEnv(key)
+}
+
+func getenv(key string) string {
+	v, _ := lookupSetting(key)
+	return v
+}
+
+func getenvInt(key string, def int) int {
+	if v, ok := lookupSetting(key); ok && v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: could not parse env var %s as int: %s. Using default %d", key, v, def)
+	}
+	return def
+}
+
+func getenvBool(key string, def bool) bool {
+	if v, ok := lookupSetting(key); ok && v != "" {
+		if parsed, err := strconv.ParseBool(v); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: could not parse env var %s as bool: %s. Using default %t", key, v, def)
+	}
+	return def
+}
+
+func getenvFloat(key string, def float64) float64 {
+	if v, ok := lookupSetting(key); ok && v != "" {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: could not parse env var %s as float: %s. Using default %g", key, v, def)
+	}
+	return def
+}
+
+func getenvStr(key, def string) string {
+	if v, ok := lookupSetting(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+func getenvDuration(key string, def time.Duration) time.Duration {
+	if v, ok := lookupSetting(key); ok && v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: could not parse env var %s as duration: %s. Using default %s", key, v, def)
+	}
+	return def
+}
+
+// parsePercentiles parses a comma-separated list of percentiles such as "50,90,99.9".
+// An empty or invalid list logs a warning and yields the defaults.
+func parsePercentiles(v string) []float64 {
+	if v == "" {
+		return defaultPercentiles
+	}
+	var out []float64
+	for _, part := range strings.Split(v, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || f < 0 || f > 100 {
+			log.Printf("Warning: could not parse percentiles %q. Using default %v", v, defaultPercentiles)
+			return defaultPercentiles
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// slaPercentiles are the latency percentiles that can be given an SLA, each
+// with its own SLA_<name>_MS variable and -sla-<name> flag.
+var slaPercentiles = []struct {
+	name       string
+	percentile float64
+}{
+	{"p50", 50},
+	{"p90", 90},
+	{"p95", 95},
+	{"p99", 99},
+	{"p999", 99.9},
+}
+
+// defaultSuccessCodes is the SUCCESS_CODES value used when it is unset or invalid.
+const defaultSuccessCodes = "200,201"
+
+// parseSuccessCodes parses a comma-separated list of status codes and
+// inclusive ranges, such as "200-299,304". An invalid list logs a warning and
+// yields the defaults.
+func parseSuccessCodes(v string) map[int]bool {
+	codes := make(map[int]bool)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			hi = lo
+		}
+		from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || from < 100 || to > 599 || from > to {
+			log.Printf("Warning: could not parse success codes %q. Using default %s", v, defaultSuccessCodes)
+			return parseSuccessCodes(defaultSuccessCodes)
+		}
+		for c := from; c <= to; c++ {
+			codes[c] = true
+		}
+	}
+	return codes
+}
+
+// parseLatencyBuckets parses ascending histogram bounds such as "5ms,50ms,1s",
+// where plain numbers are milliseconds. An empty or invalid list yields the
+// defaults, the latter with a warning.
+func parseLatencyBuckets(v string) []time.Duration {
+	if v == "" {
+		return loadtest.DefaultLatencyBuckets
+	}
+	var out []time.Duration
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		d, err := time.ParseDuration(part)
+		if ms, msErr := strconv.ParseFloat(part, 64); msErr == nil {
+			d, err = time.Duration(ms*float64(time.Millisecond)), nil
+		}
+		if err != nil || d <= 0 || (len(out) > 0 && d <= out[len(out)-1]) {
+			log.Printf("Warning: could not parse latency buckets %q. Using default %v", v, loadtest.DefaultLatencyBuckets)
+			return loadtest.DefaultLatencyBuckets
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// parseResolve parses a comma-separated list of curl-style host:port:address
+// overrides, such as "api.example.com:443:10.0.0.5". IPv6 addresses may be
+// bracketed. Malformed entries are logged and skipped.
+func parseResolve(v string) map[string]string {
+	resolve := make(map[string]string)
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, rest, ok1 := strings.Cut(entry, ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if _, err := strconv.ParseUint(port, 10, 16); !ok1 || !ok2 || host == "" || addr == "" || err != nil {
+			log.Printf("Warning: skipping malformed entry %q in RESOLVE, expected host:port:address", entry)
+			continue
+		}
+		resolve[net.JoinHostPort(strings.ToLower(host), port)] = net.JoinHostPort(addr, port)
+	}
+	return resolve
+}
+
+// byteUnits are the size suffixes accepted by parseByteSize, longest first
+// so that "KB" is not taken for "B".
+var byteUnits = []struct {
+	suffix string
+	size   int
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as "512", "64KB" or "1MB", where units
+// are powers of 1024 and case-insensitive. An invalid size logs a warning
+// and yields 0.
+func parseByteSize(v string) int {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	if s == "" {
+		return 0
+	}
+	mult := 1
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		log.Printf("Warning: could not parse size %q. Ignoring it", v)
+		return 0
+	}
+	return int(n * float64(mult))
+}
+
+// parseHeaders parses a semicolon-separated list of "Key: Value" pairs.
+// Malformed entries are logged and skipped.
+func parseHeaders(v string) map[string]string {
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(v, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			log.Printf("Warning: skipping malformed header %q in HEADERS, expected \"Key: Value\"", entry)
+			continue
+		}
+		headers[http.CanonicalHeaderKey(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// parseConfig builds the run configuration from args (usually os.Args[1:]),
+// using environment variables as defaults for flags that are not provided.
+// Invalid configurations are fatal.
+func parseConfig(args []string) loadtest.Config {
+	// load .env if present, ignore error if missing
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using defaults or environment variables")
+	}
+	// CONFIG_FILE comes last, so the environment and .env override it.
+	var fileSettings []string
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		var err error
+		if fileSettings, err = loadConfigFile(path); err != nil {
+			log.Fatalf("Invalid CONFIG_FILE: %v", err)
+		}
+	}
+
+	var (
+		cfg          loadtest.Config
+		percentiles  string
+		headers      string
+		seed         int
+		successCodes string
+		buckets      string
+		agents       string
+		resolve      string
+		localAddrs   string
+		payloadSize  string
+		maxResponse  string
+	)
+	// An empty USER_AGENT omits the header, so only an unset one falls back
+	// to the default.
+	userAgent, ok := lookupSetting("USER_AGENT")
+	if !ok {
+		userAgent = loadtest.DefaultConfig().UserAgent
+	}
+
+	fs := flag.NewFlagSet("load-tester", flag.ExitOnError)
+	fs.IntVar(&cfg.Concurrency, "concurrency", getenvInt("CONCURRENCY", 0), "number of concurrent workers, defaults to -threads (CONCURRENCY)")
+	fs.IntVar(&cfg.TotalRequests, "total", getenvInt("TOTAL_REQUESTS", 0), "total requests to issue, defaults to concurrency × -requests (TOTAL_REQUESTS)")
+	// NUM_THREADS and REQUESTS_PER_THREAD predate the job queue and are
+	// mapped onto CONCURRENCY and TOTAL_REQUESTS when those are not given.
+	threads := fs.Int("threads", getenvInt("NUM_THREADS", 20), "legacy: number of concurrent workers (NUM_THREADS)")
+	perThread := fs.Int("requests", getenvInt("REQUESTS_PER_THREAD", 50), "legacy: requests per worker, used to derive -total (REQUESTS_PER_THREAD)")
+	fs.StringVar(&cfg.TargetURL, "url", getenvStr("TARGET_URL", "http://localhost:3000/api/foo"), "target URL (TARGET_URL)")
+	fs.StringVar(&cfg.TargetURLs, "urls", getenv("TARGET_URLS"), "comma-separated target URLs to round-robin (TARGET_URLS)")
+	fs.StringVar(&cfg.Protocol, "protocol", getenvStr("PROTOCOL", "http"), "http; grpc to call the unary -grpc-method on the host:port in -url; or websocket to send the payload as messages to a ws:// or wss:// -url (PROTOCOL)")
+	fs.StringVar(&cfg.GRPCMethod, "grpc-method", getenv("GRPC_METHOD"), "gRPC method to call, as package.Service/Method, with the JSON payload as its input message (GRPC_METHOD)")
+	fs.StringVar(&cfg.GRPCProtoset, "grpc-protoset", getenv("GRPC_PROTOSET"), "descriptor set defining -grpc-method, from protoc --include_imports --descriptor_set_out; defaults to server reflection (GRPC_PROTOSET)")
+	fs.BoolVar(&cfg.GRPCTLS, "grpc-tls", getenvBool("GRPC_TLS", false), "call the gRPC target over TLS rather than plaintext (GRPC_TLS)")
+	fs.IntVar(&cfg.WSMessagesPerConn, "ws-messages-per-connection", getenvInt("WS_MESSAGES_PER_CONNECTION", 0), "messages each worker sends on a WebSocket connection before reconnecting, 0 keeps it for the whole run (WS_MESSAGES_PER_CONNECTION)")
+	fs.StringVar(&cfg.AuthToken, "token", getenv("AUTH_TOKEN"), "bearer token sent in the Authorization header (AUTH_TOKEN)")
+	fs.StringVar(&cfg.AuthTokensFile, "tokens-file", getenv("AUTH_TOKENS_FILE"), "file of bearer tokens, one per line, rotated across requests; overrides -token (AUTH_TOKENS_FILE)")
+	fs.BoolVar(&cfg.AuthTokensRandom, "tokens-random", getenvBool("AUTH_TOKENS_RANDOM", false), "pick a random token from -tokens-file for each request instead of round-robin (AUTH_TOKENS_RANDOM)")
+	fs.StringVar(&cfg.BasicAuthUser, "basic-user", getenv("BASIC_AUTH_USER"), "HTTP Basic auth user name (BASIC_AUTH_USER)")
+	fs.StringVar(&cfg.BasicAuthPass, "basic-pass", getenv("BASIC_AUTH_PASS"), "HTTP Basic auth password (BASIC_AUTH_PASS)")
+	fs.StringVar(&cfg.HMACSecret, "hmac-secret", getenv("HMAC_SECRET"), "sign every request with an HMAC of its timestamp and body under this secret (HMAC_SECRET)")
+	fs.StringVar(&cfg.HMACHeader, "hmac-header", getenvStr("HMAC_HEADER", "X-Signature"), "header the request signature is sent in (HMAC_HEADER)")
+	fs.StringVar(&cfg.HMACTimestampHeader, "hmac-timestamp-header", getenvStr("HMAC_TIMESTAMP_HEADER", "X-Timestamp"), "header the signed Unix timestamp is sent in (HMAC_TIMESTAMP_HEADER)")
+	fs.StringVar(&cfg.HMACAlgorithm, "hmac-algorithm", getenvStr("HMAC_ALGORITHM", "sha256"), "hash of the request signature: sha1, sha256, sha384 or sha512 (HMAC_ALGORITHM)")
+	fs.StringVar(&cfg.HMACEncoding, "hmac-encoding", getenvStr("HMAC_ENCODING", "hex"), "encoding of the request signature: hex or base64 (HMAC_ENCODING)")
+	fs.StringVar(&cfg.Method, "method", getenvStr("HTTP_METHOD", http.MethodPost), "HTTP method (HTTP_METHOD)")
+	fs.StringVar(&percentiles, "percentiles", getenv("PERCENTILES"), "comma-separated latency percentiles to report (PERCENTILES)")
+	fs.StringVar(&cfg.LatencyAlgo, "latency-algo", getenvStr("LATENCY_ALGO", "exact"), "how percentiles are computed: exact (log-linear histogram, within 1%) or tdigest (streaming t-digest) (LATENCY_ALGO)")
+	fs.DurationVar(&cfg.Duration, "duration", getenvDuration("DURATION", 0), "run for this long instead of a fixed request count (DURATION)")
+	fs.Float64Var(&cfg.TargetRPS, "rps", getenvFloat("TARGET_RPS", 0), "aggregate request rate cap, 0 for unbounded (TARGET_RPS)")
+	fs.DurationVar(&cfg.RequestTimeout, "timeout", getenvDuration("REQUEST_TIMEOUT", 30*time.Second), "per-request timeout, 0 to disable (REQUEST_TIMEOUT)")
+	fs.DurationVar(&cfg.DrainTimeout, "drain-timeout", getenvDuration("DRAIN_TIMEOUT", 0), "once the run ends, wait this long for requests in flight to complete, then abandon them; 0 waits for all (DRAIN_TIMEOUT)")
+	fs.StringVar(&cfg.OutputFormat, "output", getenvStr("OUTPUT_FORMAT", "text"), "summary format: text or json (OUTPUT_FORMAT)")
+	fs.DurationVar(&cfg.RampUp, "ramp-up", getenvDuration("RAMP_UP", 0), "stagger worker start-up over this window (RAMP_UP)")
+	fs.StringVar(&headers, "headers", getenv("HEADERS"), "extra headers as semicolon-separated \"Key: Value\" pairs (HEADERS)")
+	fs.StringVar(&cfg.HeaderPoolFile, "header-pool", getenv("HEADER_POOL_FILE"), "YAML file mapping header names to lists of values; each request gets one value of each at random, seeded by -seed (HEADER_POOL_FILE)")
+	fs.BoolVar(&cfg.KeepAlive, "keep-alive", getenvBool("KEEP_ALIVE", false), "reuse connections between requests (KEEP_ALIVE)")
+	fs.IntVar(&cfg.MaxIdleConnsPerHost, "max-idle-conns", getenvInt("MAX_IDLE_CONNS_PER_HOST", http.DefaultMaxIdleConnsPerHost), "idle connections kept per host with keep-alive (MAX_IDLE_CONNS_PER_HOST)")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", getenv("METRICS_ADDR"), "serve Prometheus metrics on this address (METRICS_ADDR)")
+	fs.StringVar(&cfg.StatsdAddr, "statsd-addr", getenv("STATSD_ADDR"), "push the final counters and latency summary as gauges to this statsd host:port over UDP (STATSD_ADDR)")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", getenv("OTLP_ENDPOINT"), "push the final counters and latency summary as gauges to this OpenTelemetry collector, e.g. http://localhost:4318 (OTLP_ENDPOINT)")
+	fs.StringVar(&cfg.MetricsPrefix, "metrics-prefix", getenvStr("METRICS_PREFIX", "loadtester"), "name prefix of the pushed metrics (METRICS_PREFIX)")
+	fs.StringVar(&cfg.DashboardAddr, "dashboard", getenv("DASHBOARD_ADDR"), "serve a live web dashboard of RPS, latency and errors on this address, e.g. localhost:8089 (DASHBOARD_ADDR)")
+	fs.DurationVar(&cfg.ReportInterval, "report-interval", getenvDuration("REPORT_INTERVAL", 0), "log a progress snapshot at this interval (REPORT_INTERVAL)")
+	fs.StringVar(&cfg.PayloadFile, "payload", getenvStr("PAYLOAD_FILE", "payload.json"), "request body file, - for stdin (PAYLOAD_FILE)")
+	stdin := fs.Bool("stdin", false, "read the request body from stdin, same as -payload -")
+	fs.StringVar(&cfg.PayloadDir, "payload-dir", getenv("PAYLOAD_DIR"), "send a random *.json file from this directory per request (PAYLOAD_DIR)")
+	fs.StringVar(&cfg.PayloadSequence, "payload-sequence", getenv("PAYLOAD_SEQUENCE"), "JSON array of bodies to send in order across all workers, cycling when exhausted (PAYLOAD_SEQUENCE)")
+	fs.IntVar(&seed, "seed", getenvInt("SEED", int(time.Now().UnixNano())), "random seed for reproducible runs (SEED)")
+	fs.StringVar(&cfg.ExpectBodyContains, "expect-body", getenv("EXPECT_BODY_CONTAINS"), "only count a response as success if its body contains this text (EXPECT_BODY_CONTAINS)")
+	fs.IntVar(&cfg.MaxRetries, "retries", getenvInt("MAX_RETRIES", 0), "retry 5xx responses and network errors up to this many times (MAX_RETRIES)")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", getenvDuration("RETRY_BACKOFF", 100*time.Millisecond), "initial retry delay, doubled on each attempt (RETRY_BACKOFF)")
+	fs.BoolVar(&cfg.HonorRetryAfter, "honor-retry-after", getenvBool("HONOR_RETRY_AFTER", false), "on a 429 or 503 with Retry-After, pause the worker for that long before its next request or retry (HONOR_RETRY_AFTER)")
+	fs.StringVar(&cfg.CSVOutput, "csv", getenv("CSV_OUTPUT"), "write one CSV row per request to this file (CSV_OUTPUT)")
+	fs.DurationVar(&cfg.ThinkTime, "think-time", getenvDuration("THINK_TIME", 0), "pause between consecutive requests of a worker (THINK_TIME)")
+	fs.DurationVar(&cfg.ThinkTimeJitter, "think-jitter", getenvDuration("THINK_TIME_JITTER", 0), "randomize the think time by up to ± this much (THINK_TIME_JITTER)")
+	fs.BoolVar(&cfg.HTTP2, "http2", getenvBool("HTTP2", false), "negotiate HTTP/2 over TLS; implies keep-alive (HTTP2)")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "insecure", getenvBool("INSECURE_SKIP_VERIFY", false), "skip TLS certificate verification (INSECURE_SKIP_VERIFY)")
+	fs.StringVar(&cfg.ClientCert, "client-cert", getenv("CLIENT_CERT"), "PEM client certificate for mutual TLS, used with -client-key (CLIENT_CERT)")
+	fs.StringVar(&cfg.ClientKey, "client-key", getenv("CLIENT_KEY"), "PEM private key of the client certificate (CLIENT_KEY)")
+	fs.StringVar(&cfg.CACert, "ca-cert", getenv("CA_CERT"), "PEM CA certificate to trust in addition to the system roots (CA_CERT)")
+	fs.Float64Var(&cfg.MaxFailureRate, "max-failure-rate", getenvFloat("MAX_FAILURE_RATE", getenvFloat("SLA_ERROR_RATE", -1)), "exit non-zero if the failure rate (0-1) exceeds this, negative disables (MAX_FAILURE_RATE or SLA_ERROR_RATE)")
+	fs.IntVar(&cfg.WarmupRequests, "warmup", getenvInt("WARMUP_REQUESTS", 0), "requests per worker sent before stats recording starts (WARMUP_REQUESTS)")
+	fs.DurationVar(&cfg.WarmupDuration, "warmup-duration", getenvDuration("WARMUP_DURATION", 0), "time per worker spent warming up before stats recording starts (WARMUP_DURATION)")
+	fs.BoolVar(&cfg.Progress, "progress", getenvBool("PROGRESS", false), "show a live progress bar instead of per-request logs when stderr is a terminal (PROGRESS)")
+	fs.BoolVar(&cfg.Quiet, "quiet", getenvBool("QUIET", false), "suppress per-request log lines (QUIET)")
+	fs.BoolVar(&cfg.Quiet, "q", getenvBool("QUIET", false), "shorthand for -quiet")
+	fs.StringVar(&cfg.PprofAddr, "pprof-addr", getenv("PPROF_ADDR"), "serve net/http/pprof profiles of the tester on this address (PPROF_ADDR)")
+	fs.BoolVar(&cfg.CompressRequest, "compress", getenvBool("COMPRESS_REQUEST", false), "gzip the request body and send Content-Encoding: gzip (COMPRESS_REQUEST)")
+	fs.StringVar(&maxResponse, "max-response-bytes", getenv("MAX_RESPONSE_BYTES"), "read at most this much of each response body, such as 1MB; empty reads it in full (MAX_RESPONSE_BYTES)")
+	fs.StringVar(&cfg.OversizeResponse, "oversize-response", getenvStr("OVERSIZE_RESPONSE", "truncate"), "a body over -max-response-bytes is truncated and the request judged as usual, or fail (OVERSIZE_RESPONSE)")
+	fs.BoolVar(&cfg.DecompressResponse, "decompress", getenvBool("DECOMPRESS_RESPONSE", false), "send Accept-Encoding: gzip, deflate and decode compressed responses (DECOMPRESS_RESPONSE)")
+	fs.StringVar(&cfg.ProxyURL, "proxy", getenv("PROXY_URL"), "send all requests through this proxy, overriding HTTP_PROXY/HTTPS_PROXY (PROXY_URL)")
+	fs.BoolVar(&cfg.FollowRedirects, "follow-redirects", getenvBool("FOLLOW_REDIRECTS", true), "follow redirects; when false 3xx responses are recorded as they are (FOLLOW_REDIRECTS)")
+	fs.IntVar(&cfg.MaxRedirects, "max-redirects", getenvInt("MAX_REDIRECTS", 10), "redirects a request may follow before it fails (MAX_REDIRECTS)")
+	fs.StringVar(&cfg.SetupURL, "setup-url", getenv("SETUP_URL"), "send one setup request here before the load starts (SETUP_URL)")
+	fs.StringVar(&cfg.SetupMethod, "setup-method", getenvStr("SETUP_METHOD", "POST"), "HTTP method of the setup request (SETUP_METHOD)")
+	fs.StringVar(&cfg.SetupPayload, "setup-payload", getenv("SETUP_PAYLOAD"), "file with the JSON body of the setup request (SETUP_PAYLOAD)")
+	fs.StringVar(&cfg.SetupExtract, "setup-extract", getenv("SETUP_EXTRACT"), "JSON path of the value to extract from the setup response, e.g. data.token (SETUP_EXTRACT)")
+	fs.StringVar(&cfg.SetupHeader, "setup-header", getenv("SETUP_HEADER"), "header added to every request, e.g. \"Authorization: Bearer {{.Setup}}\" (SETUP_HEADER)")
+	fs.StringVar(&successCodes, "success-codes", getenvStr("SUCCESS_CODES", defaultSuccessCodes), "comma-separated status codes or ranges counted as success, e.g. 200-299 (SUCCESS_CODES)")
+	fs.IntVar(&cfg.MaxRequests, "max-requests", getenvInt("MAX_REQUESTS", 0), "stop after this many requests in total, even before DURATION ends (MAX_REQUESTS)")
+	fs.BoolVar(&cfg.TraceTiming, "trace-timing", getenvBool("TRACE_TIMING", false), "report average DNS, connect, TLS and time-to-first-byte durations (TRACE_TIMING)")
+	fs.StringVar(&cfg.ContentType, "content-type", getenvStr("CONTENT_TYPE", "application/json"), "Content-Type of the request body; form and multipart types encode key=value payloads (CONTENT_TYPE)")
+	fs.StringVar(&cfg.MultipartFile, "multipart-file", getenv("MULTIPART_FILE"), "file uploaded as a part of multipart/form-data requests (MULTIPART_FILE)")
+	fs.StringVar(&cfg.MultipartField, "multipart-field", getenvStr("MULTIPART_FIELD", "file"), "form field name of the uploaded file (MULTIPART_FIELD)")
+	histogram := fs.Bool("latency-histogram", getenvBool("LATENCY_HISTOGRAM", false), "print a latency histogram in the summary (LATENCY_HISTOGRAM)")
+	fs.StringVar(&buckets, "latency-buckets", getenv("LATENCY_BUCKETS"), "comma-separated histogram bounds such as 5ms,50ms,1s, plain numbers are ms; implies -latency-histogram (LATENCY_BUCKETS)")
+	fs.StringVar(&cfg.ArrivalModel, "arrival-model", getenvStr("ARRIVAL_MODEL", "closed"), "closed: workers loop as fast as responses allow; open: requests arrive at -rps regardless of response times (ARRIVAL_MODEL)")
+	fs.BoolVar(&cfg.Poisson, "poisson", getenvBool("POISSON", false), "draw open model inter-arrival times from an exponential distribution around -rps (POISSON)")
+	fs.StringVar(&cfg.ScenarioFile, "scenario", getenv("SCENARIO_FILE"), "YAML file of weighted scenarios with their own method, URL, headers and payload (SCENARIO_FILE)")
+	fs.StringVar(&cfg.RawRequestFile, "raw-request", getenv("RAW_REQUEST_FILE"), "replay this complete HTTP request, e.g. one saved from a proxy; -url, if given, sets its scheme and host (RAW_REQUEST_FILE)")
+	fs.StringVar(&cfg.AccessLogFile, "access-log", getenv("ACCESS_LOG_FILE"), "replay the requests of this Common, Combined or JSON Lines access log against -base-url, once unless -duration or -total is set (ACCESS_LOG_FILE)")
+	fs.StringVar(&cfg.BaseURL, "base-url", getenv("BASE_URL"), "scheme, host and optional path prefix the paths of -access-log are sent to (BASE_URL)")
+	fs.BoolVar(&cfg.AccessLogTiming, "access-log-timing", getenvBool("ACCESS_LOG_TIMING", false), "send the requests of -access-log with the gaps between them in the log (ACCESS_LOG_TIMING)")
+	fs.StringVar(&cfg.Mode, "mode", getenvStr("MODE", "standalone"), "standalone, agent (serve runs for a coordinator) or coordinator (split the load across -agents) (MODE)")
+	fs.StringVar(&cfg.AgentAddr, "agent-addr", getenvStr("AGENT_ADDR", "127.0.0.1:7070"), "listen address of the agent control API, e.g. :7070 to accept coordinators on other hosts (AGENT_ADDR)")
+	fs.StringVar(&cfg.AgentToken, "agent-token", getenv("AGENT_TOKEN"), "shared secret agents require from coordinators, set to the same value on both (AGENT_TOKEN)")
+	fs.StringVar(&agents, "agents", getenv("AGENTS"), "comma-separated host:port of the agents a coordinator drives (AGENTS)")
+	fs.BoolVar(&cfg.CookieJar, "cookie-jar", getenvBool("COOKIE_JAR", false), "store cookies set by responses and send them on the worker's later requests (COOKIE_JAR)")
+	fs.IntVar(&cfg.MaxProcs, "max-procs", getenvInt("MAX_PROCS", 0), "limit the OS threads running Go code, 0 keeps the runtime default (MAX_PROCS)")
+	fs.StringVar(&resolve, "resolve", getenv("RESOLVE"), "comma-separated host:port:address entries that connect to address instead of resolving host, like curl --resolve (RESOLVE)")
+	fs.StringVar(&localAddrs, "local-addr", getenv("LOCAL_ADDR"), "source IP to connect from; a comma-separated list is rotated across workers to spread ephemeral ports (LOCAL_ADDR)")
+	fs.StringVar(&cfg.UnixSocket, "unix-socket", getenv("UNIX_SOCKET"), "connect to this Unix socket instead of the URL's host, which still sets Host and the path (UNIX_SOCKET)")
+	fs.StringVar(&cfg.LogFormat, "log-format", getenvStr("LOG_FORMAT", "text"), "log format: text, or json for one JSON object per line (LOG_FORMAT)")
+	fs.Float64Var(&cfg.AbortErrorRate, "abort-error-rate", getenvFloat("ABORT_ERROR_RATE", 0), "abort the test once the failure rate (0-1) over the last -abort-window requests exceeds this, 0 disables (ABORT_ERROR_RATE)")
+	fs.IntVar(&cfg.AbortWindow, "abort-window", getenvInt("ABORT_WINDOW", 100), "number of recent requests the abort failure rate is computed over (ABORT_WINDOW)")
+	fs.StringVar(&payloadSize, "payload-size", getenv("PAYLOAD_SIZE"), "send a generated body of this size, e.g. 512, 1KB or 1MB, instead of -payload (PAYLOAD_SIZE)")
+	fs.StringVar(&cfg.ResponseSchema, "response-schema", getenv("RESPONSE_SCHEMA"), "JSON Schema file every successful response body must match (RESPONSE_SCHEMA)")
+	fs.IntVar(&cfg.MaxInflight, "max-inflight", getenvInt("MAX_INFLIGHT", 0), "never have more than this many requests outstanding at once, 0 for no limit (MAX_INFLIGHT)")
+	fs.StringVar(&cfg.TimeSeriesFile, "timeseries", getenv("TIMESERIES_FILE"), "write per-window request counts and p50/p95/p99 latency as JSON lines to this file, - for stdout (TIMESERIES_FILE)")
+	fs.DurationVar(&cfg.TimeSeriesInterval, "timeseries-interval", getenvDuration("TIMESERIES_INTERVAL", time.Second), "window length of the latency time series (TIMESERIES_INTERVAL)")
+	fs.StringVar(&cfg.CaptureFile, "capture", getenv("CAPTURE_FILE"), "dump sampled requests and responses (body truncated) to this file for debugging (CAPTURE_FILE)")
+	fs.Float64Var(&cfg.CaptureSampleRate, "capture-rate", getenvFloat("CAPTURE_SAMPLE_RATE", 1), "fraction of requests captured, e.g. 0.001 for 1 in 1000 (CAPTURE_SAMPLE_RATE)")
+	fs.DurationVar(&cfg.DialTimeout, "dial-timeout", getenvDuration("DIAL_TIMEOUT", 30*time.Second), "limit on establishing a TCP connection, 0 for none (DIAL_TIMEOUT)")
+	fs.DurationVar(&cfg.TLSHandshakeTimeout, "tls-handshake-timeout", getenvDuration("TLS_HANDSHAKE_TIMEOUT", 10*time.Second), "limit on the TLS handshake, 0 for none (TLS_HANDSHAKE_TIMEOUT)")
+	fs.DurationVar(&cfg.ResponseHeaderTimeout, "response-header-timeout", getenvDuration("RESPONSE_HEADER_TIMEOUT", 0), "limit on waiting for response headers after the request is sent, 0 for none (RESPONSE_HEADER_TIMEOUT)")
+	fs.DurationVar(&cfg.IdleConnTimeout, "idle-conn-timeout", getenvDuration("IDLE_CONN_TIMEOUT", 90*time.Second), "how long a kept-alive connection may sit idle, 0 for no limit (IDLE_CONN_TIMEOUT)")
+	fs.BoolVar(&cfg.DryRun, "dry-run", getenvBool("DRY_RUN", false), "check the configuration and print one sample request per target without sending anything (DRY_RUN)")
+	fs.BoolVar(&cfg.ResourceStats, "resource-stats", getenvBool("RESOURCE_STATS", false), "report the tester's own peak goroutine count and heap usage (RESOURCE_STATS)")
+	fs.BoolVar(&cfg.PerThreadStats, "per-thread-stats", getenvBool("PER_THREAD_STATS", false), "break the summary down by worker: requests, success/failure and latency of each (PER_THREAD_STATS)")
+	fs.BoolVar(&cfg.CorrectCoordinatedOmission, "correct-co", getenvBool("CORRECT_COORDINATED_OMISSION", false), "with -rps, measure latency from when each request was scheduled rather than sent, so server stalls show up in the tail (CORRECT_COORDINATED_OMISSION)")
+	slaMs := make([]float64, len(slaPercentiles))
+	for i, s := range slaPercentiles {
+		fs.Float64Var(&slaMs[i], "sla-"+s.name, getenvFloat("SLA_"+strings.ToUpper(s.name)+"_MS", 0), fmt.Sprintf("exit non-zero if the p%g latency exceeds this many ms, 0 disables (SLA_%s_MS)", s.percentile, strings.ToUpper(s.name)))
+	}
+	fs.StringVar(&cfg.JSONLOutput, "jsonl", getenv("JSONL_OUTPUT"), "write one JSON object per request, including response headers, to this file (JSONL_OUTPUT)")
+	fs.BoolVar(&cfg.NoBanner, "no-banner", getenvBool("NO_BANNER", false), "machine mode: no start-up banner or separators, and with -output json no text summary either (NO_BANNER)")
+	fs.StringVar(&cfg.UserAgent, "user-agent", userAgent, "User-Agent header of every request, empty to leave it out (USER_AGENT)")
+	fs.BoolVar(&cfg.IdempotencyKey, "idempotency-header", getenvBool("IDEMPOTENCY_HEADER", false), "send a fresh UUID per request, reused by its retries, in the -idempotency-header-name header (IDEMPOTENCY_HEADER)")
+	fs.StringVar(&cfg.IdempotencyHeader, "idempotency-header-name", getenvStr("IDEMPOTENCY_HEADER_NAME", "Idempotency-Key"), "header the idempotency key is sent in (IDEMPOTENCY_HEADER_NAME)")
+	fs.StringVar(&cfg.TargetURLA, "url-a", getenv("TARGET_URL_A"), "compare this target against -url-b, splitting the load evenly between them (TARGET_URL_A)")
+	fs.StringVar(&cfg.TargetURLB, "url-b", getenv("TARGET_URL_B"), "second target of an A/B comparison (TARGET_URL_B)")
+	rateSchedule := fs.String("rate-schedule", getenv("RATE_SCHEDULE"), "file of duration:rps steps, such as 1m:100, to follow instead of a fixed -rps; the run lasts as long as the steps unless -duration is set (RATE_SCHEDULE)")
+	// By now every setting has been read once, catching misspelt keys in
+	// the config file.
+	for _, name := range fileSettings {
+		if !knownSettings[name] {
+			log.Printf("Warning: CONFIG_FILE sets %s, which is not a known setting", name)
+		}
+	}
+	fs.Parse(args)
+
+	cfg.Method = strings.ToUpper(cfg.Method)
+	cfg.Protocol = strings.ToLower(cfg.Protocol)
+	cfg.LatencyAlgo = strings.ToLower(cfg.LatencyAlgo)
+	cfg.SetupMethod = strings.ToUpper(cfg.SetupMethod)
+	cfg.ArrivalModel = strings.ToLower(cfg.ArrivalModel)
+	cfg.OutputFormat = strings.ToLower(cfg.OutputFormat)
+	cfg.Mode = strings.ToLower(cfg.Mode)
+	cfg.LogFormat = strings.ToLower(cfg.LogFormat)
+	cfg.OversizeResponse = strings.ToLower(cfg.OversizeResponse)
+	for _, a := range strings.Split(agents, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.Agents = append(cfg.Agents, a)
+		}
+	}
+	for _, a := range strings.Split(localAddrs, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.LocalAddrs = append(cfg.LocalAddrs, a)
+		}
+	}
+	cfg.Percentiles = parsePercentiles(percentiles)
+	cfg.Headers = parseHeaders(headers)
+	cfg.Resolve = parseResolve(resolve)
+	cfg.PayloadSize = parseByteSize(payloadSize)
+	cfg.MaxResponseBytes = int64(parseByteSize(maxResponse))
+	cfg.SuccessCodes = parseSuccessCodes(successCodes)
+	if *histogram || buckets != "" {
+		cfg.LatencyBuckets = parseLatencyBuckets(buckets)
+	}
+	cfg.Seed = int64(seed)
+	for i, ms := range slaMs {
+		if ms > 0 {
+			cfg.LatencySLAs = append(cfg.LatencySLAs, loadtest.LatencySLA{Percentile: slaPercentiles[i].percentile, Max: time.Duration(ms * float64(time.Millisecond))})
+		}
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = *threads
+	}
+	if cfg.TotalRequests <= 0 {
+		cfg.TotalRequests = cfg.Concurrency * *perThread
+	}
+	if cfg.HTTP2 {
+		cfg.KeepAlive = true // multiplexing needs long-lived connections
+	}
+	if *stdin {
+		cfg.PayloadFile = "-"
+	}
+	if cfg.RawRequestFile != "" {
+		// The default TARGET_URL must not redirect the raw request; only one
+		// given explicitly says where to replay it.
+		urlSet := os.Getenv("TARGET_URL") != ""
+		fs.Visit(func(f *flag.Flag) { urlSet = urlSet || f.Name == "url" })
+		if !urlSet {
+			cfg.TargetURL = ""
+		}
+		if cfg.TargetURLs != "" {
+			log.Println("Warning: RAW_REQUEST_FILE is set, ignoring TARGET_URLS")
+		}
+	}
+	if *rateSchedule != "" {
+		steps, err := loadtest.LoadRateSchedule(*rateSchedule)
+		if err != nil {
+			log.Fatalf("Invalid RATE_SCHEDULE: %v", err)
+		}
+		cfg.RateSchedule = steps
+	}
+
+	if cfg.TargetURL == "" && cfg.TargetURLs == "" && cfg.RawRequestFile == "" {
+		log.Fatal("TARGET_URL must be set either in .env, as an environment variable or with -url")
+	}
+	if cfg.OutputFormat != "text" && cfg.OutputFormat != "json" {
+		log.Fatalf("OUTPUT_FORMAT must be either text or json, got %q", cfg.OutputFormat)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if cfg.BasicAuthUser != "" && cfg.BasicAuthPass != "" && cfg.AuthToken != "" {
+		log.Println("Warning: both BASIC_AUTH_USER/BASIC_AUTH_PASS and AUTH_TOKEN are set, using Basic auth and ignoring AUTH_TOKEN")
+	}
+	if cfg.BasicAuthUser != "" && cfg.BasicAuthPass != "" && cfg.AuthTokensFile != "" {
+		log.Println("Warning: both BASIC_AUTH_USER/BASIC_AUTH_PASS and AUTH_TOKENS_FILE are set, using Basic auth and ignoring AUTH_TOKENS_FILE")
+	} else if cfg.AuthTokensFile != "" && cfg.AuthToken != "" {
+		log.Println("Warning: both AUTH_TOKENS_FILE and AUTH_TOKEN are set, using AUTH_TOKENS_FILE")
+	}
+
+	if cfg.PayloadSequence != "" && (cfg.PayloadSize > 0 || cfg.PayloadDir != "" || *stdin) {
+		log.Println("Warning: PAYLOAD_SEQUENCE is set, ignoring PAYLOAD_SIZE, PAYLOAD_DIR and stdin")
+	} else if cfg.PayloadSize > 0 && (cfg.PayloadDir != "" || *stdin) {
+		log.Println("Warning: PAYLOAD_SIZE is set, ignoring PAYLOAD_DIR and stdin")
+	}
+	if cfg.TargetURLA != "" && cfg.TargetURLB != "" {
+		if cfg.TargetURLs != "" {
+			log.Println("Warning: TARGET_URL_A/TARGET_URL_B are set, ignoring TARGET_URLS")
+		}
+		if cfg.MetricsAddr != "" {
+			log.Println("Warning: METRICS_ADDR is not supported in A/B mode and is ignored")
+		}
+		if cfg.DashboardAddr != "" {
+			log.Println("Warning: DASHBOARD_ADDR is not supported in A/B mode and is ignored")
+		}
+		if cfg.StatsdAddr != "" || cfg.OTLPEndpoint != "" {
+			log.Println("Warning: STATSD_ADDR and OTLP_ENDPOINT are not supported in A/B mode and are ignored")
+		}
+	}
+	if cfg.UnixSocket != "" && (len(cfg.Resolve) > 0 || cfg.ProxyURL != "" || len(cfg.LocalAddrs) > 0) {
+		log.Println("Warning: UNIX_SOCKET is set, ignoring RESOLVE, PROXY_URL and LOCAL_ADDR")
+	}
+	if len(cfg.RateSchedule) > 0 && cfg.TargetRPS > 0 {
+		log.Println("Warning: both RATE_SCHEDULE and TARGET_RPS are set, following RATE_SCHEDULE")
+	}
+
+	requestsSet := os.Getenv("REQUESTS_PER_THREAD") != "" || os.Getenv("TOTAL_REQUESTS") != ""
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "requests" || f.Name == "total" {
+			requestsSet = true
+		}
+	})
+	if requestsSet && cfg.Duration > 0 {
+		log.Printf("Warning: both DURATION and a request count are set, DURATION (%s) takes precedence", cfg.Duration)
+	}
+	if cfg.AccessLogFile != "" && !requestsSet {
+		cfg.TotalRequests = 0 // replay the log once
+	}
+	return cfg
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"loadtester_go/loadtest"
+)
+
+// captureLog sends the log output of the test to the returned buffer.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestParsePercentiles(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []float64
+	}{
+		{"", defaultPercentiles},
+		{"50,90,99.9", []float64{50, 90, 99.9}},
+		{" 75 , 100 ", []float64{75, 100}},
+		{"0", []float64{0}},
+		{"50,abc", defaultPercentiles},
+		{"101", defaultPercentiles},
+		{"-1", defaultPercentiles},
+	}
+	captureLog(t)
+	for _, tt := range tests {
+		if got := parsePercentiles(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parsePercentiles(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSuccessCodes(t *testing.T) {
+	defaults := map[int]bool{200: true, 201: true}
+	tests := []struct {
+		in   string
+		want map[int]bool
+	}{
+		{"200,201", defaults},
+		{"204", map[int]bool{204: true}},
+		{"200-203, 304", map[int]bool{200: true, 201: true, 202: true, 203: true, 304: true}},
+		{"299-200", defaults},
+		{"99", defaults},
+		{"600", defaults},
+		{"ok", defaults},
+		{"", defaults},
+	}
+	captureLog(t)
+	for _, tt := range tests {
+		if got := parseSuccessCodes(tt.in); !maps.Equal(got, tt.want) {
+			t.Errorf("parseSuccessCodes(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseLatencyBuckets(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []time.Duration
+	}{
+		{"", loadtest.DefaultLatencyBuckets},
+		{"5ms,50ms,1s", []time.Duration{5 * time.Millisecond, 50 * time.Millisecond, time.Second}},
+		{"10, 2.5s", []time.Duration{10 * time.Millisecond, 2500 * time.Millisecond}},
+		{"0.5", []time.Duration{500 * time.Microsecond}},
+		{"50ms,5ms", loadtest.DefaultLatencyBuckets},
+		{"5ms,5ms", loadtest.DefaultLatencyBuckets},
+		{"0", loadtest.DefaultLatencyBuckets},
+		{"fast", loadtest.DefaultLatencyBuckets},
+	}
+	captureLog(t)
+	for _, tt := range tests {
+		if got := parseLatencyBuckets(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parseLatencyBuckets(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"64KB", 64 << 10},
+		{"1mb", 1 << 20},
+		{" 2 GB ", 2 << 30},
+		{"1.5KB", 1536},
+		{"-1KB", 0},
+		{"lots", 0},
+	}
+	captureLog(t)
+	for _, tt := range tests {
+		if got := parseByteSize(tt.in); got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"X-Api-Key: abc", map[string]string{"X-Api-Key": "abc"}},
+		{"x-one: 1; accept:text/plain ;", map[string]string{"X-One": "1", "Accept": "text/plain"}},
+		{"Authorization: Bearer a:b", map[string]string{"Authorization": "Bearer a:b"}},
+		{"X-Empty:", map[string]string{"X-Empty": ""}},
+		{"novalue; : nokey; X-Ok: 1", map[string]string{"X-Ok": "1"}},
+	}
+	captureLog(t)
+	for _, tt := range tests {
+		if got := parseHeaders(tt.in); !maps.Equal(got, tt.want) {
+			t.Errorf("parseHeaders(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"api.example.com:443:10.0.0.5", map[string]string{"api.example.com:443": "10.0.0.5:443"}},
+		{"API.example.com:80:[::1], b:8080:127.0.0.1", map[string]string{"api.example.com:80": "[::1]:80", "b:8080": "127.0.0.1:8080"}},
+		{"nohost, a:99999:10.0.0.1, :80:10.0.0.1, a:80:", map[string]string{}},
+	}
+	captureLog(t)
+	for _, tt := range tests {
+		if got := parseResolve(tt.in); !maps.Equal(got, tt.want) {
+			t.Errorf("parseResolve(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	captureLog(t)
+	t.Setenv("TARGET_URL", "http://localhost:3000/api/foo")
+	t.Setenv("NUM_THREADS", "4")
+	t.Setenv("REQUESTS_PER_THREAD", "25")
+	t.Setenv("HTTP_METHOD", "get")
+	t.Setenv("PERCENTILES", "50,99")
+	t.Setenv("HTTP2", "true")
+	t.Setenv("LATENCY_BUCKETS", "10ms,100ms")
+	t.Setenv("SLA_ERROR_RATE", "0.05")
+	t.Setenv("SLA_P99_MS", "250")
+
+	cfg := parseConfig([]string{
+		"-threads", "8",
+		"-latency-algo", "TDigest",
+	})
+	if cfg.Concurrency != 8 || cfg.TotalRequests != 200 {
+		t.Errorf("concurrency %d and total %d, want 8 from the flag and 8*25 = 200", cfg.Concurrency, cfg.TotalRequests)
+	}
+	if cfg.Method != "GET" {
+		t.Errorf("method %q, want it normalized to GET", cfg.Method)
+	}
+	if !slices.Equal(cfg.Percentiles, []float64{50, 99}) {
+		t.Errorf("percentiles %v, want [50 99]", cfg.Percentiles)
+	}
+	if !cfg.KeepAlive {
+		t.Error("HTTP2 did not imply keep-alive")
+	}
+	if !slices.Equal(cfg.LatencyBuckets, []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}) {
+		t.Errorf("latency buckets %v, want [10ms 100ms]", cfg.LatencyBuckets)
+	}
+	if cfg.AgentAddr != "127.0.0.1:7070" {
+		t.Errorf("agent address %q, want it to default to localhost", cfg.AgentAddr)
+	}
+	if cfg.MaxFailureRate != 0.05 {
+		t.Errorf("max failure rate %g, want 0.05 from SLA_ERROR_RATE", cfg.MaxFailureRate)
+	}
+	if want := []loadtest.LatencySLA{{Percentile: 99, Max: 250 * time.Millisecond}}; !slices.Equal(cfg.LatencySLAs, want) {
+		t.Errorf("latency SLAs %v, want %v", cfg.LatencySLAs, want)
+	}
+	if cfg.LatencyAlgo != "tdigest" {
+		t.Errorf("latency algorithm %q, want it normalized to tdigest", cfg.LatencyAlgo)
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "load.yaml")
+	settings := "target_url: http://localhost:3000/api/foo\nmax_failure_rate: 0.1\nsla_error_rate: 0.2\nhttp_method: put\nconcurrency: 3\nbogus_key: 1\n"
+	if err := os.WriteFile(path, []byte(settings), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// loadConfigFile sets the variables the environment does not.
+	for _, name := range []string{"TARGET_URL", "MAX_FAILURE_RATE", "SLA_ERROR_RATE", "CONCURRENCY", "BOGUS_KEY"} {
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("HTTP_METHOD", "delete")
+	logs := captureLog(t)
+
+	cfg := parseConfig(nil)
+	if cfg.MaxFailureRate != 0.1 {
+		t.Errorf("max failure rate %g, want 0.1 from MAX_FAILURE_RATE", cfg.MaxFailureRate)
+	}
+	if cfg.Method != "DELETE" || cfg.Concurrency != 3 {
+		t.Errorf("method %q and concurrency %d, want DELETE from the environment and 3 from the file", cfg.Method, cfg.Concurrency)
+	}
+	var warnings []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "not a known setting") {
+			warnings = append(warnings, line)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "BOGUS_KEY") {
+		t.Errorf("unknown setting warnings %q, want one for BOGUS_KEY", warnings)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configListSeparators are the separators of the settings whose lists are
+// not comma-separated, first between entries, then between a map entry's key
+// and value.
+var configListSeparators = map[string][2]string{
+	"HEADERS": {"; ", ": "},
+}
+
+// loadConfigFile reads a CONFIG_FILE, YAML or TOML, whose keys are the
+// names of the environment variables in any case, and sets those not
+// already set, so that like .env the file only supplies defaults. Besides
+// scalars a value may be a list, joined with commas, or a map such as
+// HEADERS or RESOLVE, whose entries are joined as key:value pairs. It
+// returns the names set.
+func loadConfigFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	var settings map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".toml":
+		err = toml.Unmarshal(data, &settings)
+	default:
+		return nil, fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	var names []string
+	for key, v := range settings {
+		name := strings.ToUpper(key)
+		value, err := configValue(name, v)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		os.Setenv(name, value)
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// configValue renders v as the environment variable name would hold it.
+func configValue(name string, v any) (string, error) {
+	sep := [2]string{",", ":"}
+	if s, ok := configListSeparators[name]; ok {
+		sep = s
+	}
+	switch v := v.(type) {
+	case []any:
+		out := make([]string, len(v))
+		for i, e := range v {
+			s, err := configScalar(e)
+			if err != nil {
+				return "", err
+			}
+			out[i] = s
+		}
+		return strings.Join(out, sep[0]), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		out := make([]string, len(keys))
+		for i, k := range keys {
+			s, err := configScalar(v[k])
+			if err != nil {
+				return "", err
+			}
+			out[i] = k + sep[1] + s
+		}
+		return strings.Join(out, sep[0]), nil
+	}
+	return configScalar(v)
+}
+
+func configScalar(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported value %v, expected a string, number, boolean, list or map", v)
+}
@@ -0,0 +1,185 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// abRegression is the relative slowdown of B from which LogABReport flags a
+// latency delta.
+const abRegression = 0.10
+
+// abSides names the two halves of an A/B run, in order.
+var abSides = [2]string{"A", "B"}
+
+// ABReport is the result of RunAB: a full report for each target and the
+// difference between them.
+type ABReport struct {
+	A    Report `json:"a"`
+	B    Report `json:"b"`
+	Diff ABDiff `json:"diff"`
+}
+
+// ABDiff holds B minus A for the headline numbers, so positive latency and
+// failure rate deltas mean B did worse.
+type ABDiff struct {
+	AvgMs       float64            `json:"avg_ms"`
+	Percentiles map[string]float64 `json:"percentiles_ms"`
+	FailureRate float64            `json:"failure_rate"`
+	RPS         float64            `json:"rps"`
+}
+
+// abMode reports whether cfg compares TargetURLA against TargetURLB.
+func (c Config) abMode() bool {
+	return c.TargetURLA != "" || c.TargetURLB != ""
+}
+
+// abShare returns the half of cfg that side i of an A/B run sends. Both
+// sides draw the same random values, so they receive identical traffic.
+// Per-request output files get the side as a suffix, and the per-request and
+// progress lines of two concurrent runs would be indistinguishable, so they
+// are turned off.
+func abShare(cfg Config, i int) Config {
+	share := splitConfig(cfg, 2, i)
+	share.TargetURL = cfg.TargetURLA
+	if i == 1 {
+		share.TargetURL = cfg.TargetURLB
+	}
+	share.TargetURLA, share.TargetURLB, share.TargetURLs = "", "", ""
+	share.NoBanner, share.Quiet, share.Progress, share.ReportInterval = true, true, false, 0
+	share.MetricsAddr, share.DashboardAddr = "", ""
+	if i == 1 {
+		share.PprofAddr = "" // profiles cover the whole process already
+	}
+	for _, path := range []*string{&share.CSVOutput, &share.JSONLOutput, &share.CaptureFile, &share.TimeSeriesFile} {
+		*path = abPath(*path, abSides[i])
+	}
+	return share
+}
+
+// abPath inserts the side into a file name, e.g. results.csv becomes
+// results-a.csv. Empty paths and "-" for stdout are left alone.
+func abPath(path, side string) string {
+	if path == "" || path == "-" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + strings.ToLower(side) + ext
+}
+
+// RunAB runs the load of cfg against TargetURLA and TargetURLB at the same
+// time, each with half the workers, requests and rate, and compares the
+// results. Cancelling ctx stops both sides like it stops Run.
+func RunAB(ctx context.Context, cfg Config) (ABReport, error) {
+	if err := cfg.Validate(); err != nil {
+		return ABReport{}, err
+	}
+	if !cfg.NoBanner {
+		log.Printf("🆚 Comparing two targets under identical load...")
+		for i, side := range abSides {
+			share := abShare(cfg, i)
+			log.Printf("  %s: %s with concurrency %d", side, share.TargetURL, share.Concurrency)
+		}
+		log.Printf("Per-request log lines are off in A/B mode")
+		log.Printf("----------------------------------------------------------------------")
+	}
+
+	// If one side cannot start, the other is stopped rather than left to
+	// run a comparison that cannot be made.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		reports [2]Report
+		errs    [2]error
+		wg      sync.WaitGroup
+	)
+	for i := range abSides {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reports[i], errs[i] = Run(ctx, abShare(cfg, i)); errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return ABReport{}, fmt.Errorf("target %s: %w", abSides[i], err)
+		}
+	}
+
+	r := ABReport{A: reports[0], B: reports[1]}
+	r.Diff = ABDiff{
+		AvgMs:       r.B.Latency.Avg - r.A.Latency.Avg,
+		Percentiles: make(map[string]float64, len(r.A.Latency.Percentiles)),
+		FailureRate: r.B.FailureRate - r.A.FailureRate,
+		RPS:         r.B.RPS - r.A.RPS,
+	}
+	for label, a := range r.A.Latency.Percentiles {
+		r.Diff.Percentiles[label] = r.B.Latency.Percentiles[label] - a
+	}
+	return r, nil
+}
+
+// LogABReport prints the report of each side followed by the comparison.
+// Latency deltas where B is more than 10% slower are flagged.
+func LogABReport(cfg Config, r ABReport) {
+	for i, side := range [2]Report{r.A, r.B} {
+		share := abShare(cfg, i)
+		log.Printf("======================== %s: %s", abSides[i], share.TargetURL)
+		LogReport(share, side)
+	}
+
+	log.Printf("======================== A/B comparison (B - A)")
+	logABDelta("avg latency", r.A.Latency.Avg, r.B.Latency.Avg, "ms", false)
+	for _, p := range cfg.Percentiles {
+		label := percentileLabel(p)
+		logABDelta(label+" latency", r.A.Latency.Percentiles[label], r.B.Latency.Percentiles[label], "ms", false)
+	}
+	log.Printf("  %-14s %9.2f%% -> %9.2f%%  (%+.2f points)%s", "failure rate",
+		r.A.FailureRate*100, r.B.FailureRate*100, r.Diff.FailureRate*100, abFlag(r.Diff.FailureRate > 0))
+	logABDelta("throughput", r.A.RPS, r.B.RPS, "RPS", true)
+}
+
+// logABDelta prints one row of the comparison. higherIsBetter tells which
+// direction of change counts as a regression.
+func logABDelta(name string, a, b float64, unit string, higherIsBetter bool) {
+	change := ""
+	regressed := false
+	if a > 0 {
+		rel := (b - a) / a
+		change = fmt.Sprintf(", %+.1f%%", rel*100)
+		if higherIsBetter {
+			regressed = rel < -abRegression
+		} else {
+			regressed = rel > abRegression
+		}
+	}
+	log.Printf("  %-14s %9.2f %s -> %9.2f %s  (%+.2f %s%s)%s", name, a, unit, b, unit, b-a, unit, change, abFlag(regressed))
+}
+
+func abFlag(regressed bool) string {
+	if regressed {
+		return "  ⚠️ B worse"
+	}
+	return ""
+}
+
+// ABThresholdsPassed checks both sides against the thresholds in cfg.
+func ABThresholdsPassed(cfg Config, r ABReport) bool {
+	passed := true
+	for i, side := range [2]Report{r.A, r.B} {
+		if cfg.MaxFailureRate >= 0 || len(cfg.LatencySLAs) > 0 || side.Aborted {
+			log.Printf("Thresholds for %s:", abSides[i])
+		}
+		if !ThresholdsPassed(abShare(cfg, i), side) {
+			passed = false
+		}
+	}
+	return passed
+}
@@ -0,0 +1,192 @@
+package loadtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// logEntry is one request read from an ACCESS_LOG_FILE.
+type logEntry struct {
+	method string
+	path   string    // path and query, as logged
+	at     time.Time // zero if the line has no timestamp
+	line   int
+}
+
+// commonLogLine matches the Common and Combined log formats up to the
+// request line, e.g.
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326
+var commonLogLine = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*"`)
+
+// commonLogTime is the timestamp layout of the Common Log Format.
+const commonLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// loadAccessLog reads the requests of an access log in the Common or
+// Combined format, or with one JSON object per line. JSON lines give the
+// method in method, request_method or verb, the path in path, uri,
+// request_uri or url, or both as a request line in request, and the time in
+// time, timestamp, @timestamp or time_local. The format is detected per line;
+// lines that are neither, or whose method is not supported, are skipped with
+// a warning.
+func loadAccessLog(path string) ([]logEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read access log: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		entries []logEntry
+		skipped int
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // combined lines with long user agents
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		e, ok := parseLogLine(line)
+		if !ok || !validMethods[e.method] {
+			skipped++
+			continue
+		}
+		e.line = n
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read access log: %w", err)
+	}
+	if skipped > 0 {
+		log.Printf("Warning: skipped %d unrecognized lines in %s", skipped, path)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("access log %s has no requests in a recognized format", path)
+	}
+	return entries, nil
+}
+
+// parseLogLine reads one access log line in either supported format.
+func parseLogLine(line string) (logEntry, bool) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLogLine(line)
+	}
+	m := commonLogLine.FindStringSubmatch(line)
+	if m == nil {
+		return logEntry{}, false
+	}
+	at, _ := time.Parse(commonLogTime, m[1])
+	return logEntry{method: strings.ToUpper(m[2]), path: m[3], at: at}, true
+}
+
+func parseJSONLogLine(line string) (logEntry, bool) {
+	var fields map[string]any
+	if json.Unmarshal([]byte(line), &fields) != nil {
+		return logEntry{}, false
+	}
+	str := func(keys ...string) string {
+		for _, k := range keys {
+			if s, ok := fields[k].(string); ok && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+	e := logEntry{method: str("method", "request_method", "verb"), path: str("path", "uri", "request_uri", "url")}
+	if reqLine := str("request"); reqLine != "" && (e.method == "" || e.path == "") {
+		parts := strings.Fields(reqLine)
+		if len(parts) >= 2 {
+			e.method, e.path = parts[0], parts[1]
+		}
+	}
+	if e.method == "" || e.path == "" {
+		return logEntry{}, false
+	}
+	e.method = strings.ToUpper(e.method)
+	if i := strings.Index(e.path, "://"); i >= 0 {
+		// An absolute URL; only the path is replayed against BASE_URL.
+		rest := e.path[i+3:]
+		if j := strings.IndexAny(rest, "/?"); j >= 0 {
+			e.path = rest[j:]
+		} else {
+			e.path = "/"
+		}
+	}
+	for _, k := range []string{"time", "timestamp", "@timestamp", "time_local"} {
+		switch v := fields[k].(type) {
+		case string:
+			for _, layout := range []string{time.RFC3339Nano, commonLogTime} {
+				if at, err := time.Parse(layout, v); err == nil {
+					e.at = at
+					break
+				}
+			}
+		case float64: // seconds since the epoch
+			e.at = time.Unix(0, int64(v*float64(time.Second)))
+		}
+		if !e.at.IsZero() {
+			break
+		}
+	}
+	return e, true
+}
+
+// replay hands out the requests of an access log in order, cycling through
+// it if the run outlasts the log. There is one target per method, so the
+// report breaks the replayed traffic down by method.
+type replay struct {
+	entries []logEntry
+	targets map[string]*target // by method, each with BASE_URL as its URL
+	span    time.Duration      // first to last timestamp, plus one mean gap
+}
+
+// newReplay prepares entries for sending to base. With timed set every
+// entry needs a timestamp, as requests are then sent at the logged offsets.
+func newReplay(entries []logEntry, base string, timed bool) (*replay, *targetSet, error) {
+	rp := &replay{entries: entries, targets: make(map[string]*target)}
+	base = strings.TrimSuffix(base, "/")
+	ts := &targetSet{}
+	for _, e := range entries {
+		if timed && e.at.IsZero() {
+			return nil, nil, fmt.Errorf("ACCESS_LOG_TIMING needs a timestamp on every request, but line %d has none", e.line)
+		}
+		if rp.targets[e.method] == nil {
+			t, err := newTarget(base)
+			if err != nil {
+				return nil, nil, err
+			}
+			t.method, t.name = e.method, e.method+" (replayed)"
+			rp.targets[e.method] = t
+			ts.list = append(ts.list, t)
+		}
+	}
+	if timed {
+		if last := entries[len(entries)-1].at.Sub(entries[0].at); last > 0 {
+			rp.span = last + last/time.Duration(max(len(entries)-1, 1))
+		}
+	}
+	return rp, ts, nil
+}
+
+// request returns the target of request n, counting from 1, and the path to
+// append to its URL.
+func (rp *replay) request(n int) (*target, string) {
+	e := rp.entries[(n-1)%len(rp.entries)]
+	return rp.targets[e.method], e.path
+}
+
+// offset returns when request n is due after the start of the run, keeping
+// the logged gaps between requests. Entries logged out of order are sent
+// as soon as their turn comes.
+func (rp *replay) offset(n int) time.Duration {
+	i := (n - 1) % len(rp.entries)
+	cycle := time.Duration((n - 1) / len(rp.entries))
+	return cycle*rp.span + max(rp.entries[i].at.Sub(rp.entries[0].at), 0)
+}
@@ -0,0 +1,62 @@
+package loadtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	at := time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+	tests := []struct {
+		line   string
+		want   logEntry
+		wantOK bool
+	}{
+		{`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif?x=1 HTTP/1.0" 200 2326`, logEntry{method: "GET", path: "/a.gif?x=1", at: at}, true},
+		{`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "post /orders HTTP/1.1" 201 0 "-" "curl/8.5.0"`, logEntry{method: "POST", path: "/orders", at: at}, true},
+		{`{"method":"delete","path":"/items/7","time":"2000-10-10T13:55:36-07:00"}`, logEntry{method: "DELETE", path: "/items/7", at: at}, true},
+		{`{"request":"GET /search?q=go HTTP/2.0","@timestamp":971211336}`, logEntry{method: "GET", path: "/search?q=go", at: time.Unix(971211336, 0)}, true},
+		{`{"verb":"PUT","url":"https://api.example.com/v1/x?y=2"}`, logEntry{method: "PUT", path: "/v1/x?y=2"}, true},
+		{`{"method":"GET"}`, logEntry{}, false},
+		{`not a log line`, logEntry{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLogLine(tt.line)
+		if ok != tt.wantOK || got.method != tt.want.method || got.path != tt.want.path || !got.at.Equal(tt.want.at) {
+			t.Errorf("parseLogLine(%q) = %+v, %t, want %+v, %t", tt.line, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestReplayOffset(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []logEntry{
+		{method: "GET", path: "/a", at: start, line: 1},
+		{method: "POST", path: "/b", at: start.Add(2 * time.Second), line: 2},
+		{method: "GET", path: "/c", at: start.Add(time.Second), line: 3}, // logged out of order
+		{method: "GET", path: "/d", at: start.Add(4 * time.Second), line: 4},
+	}
+	rp, ts, err := newReplay(entries, "http://localhost:3000/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.list) != 2 {
+		t.Errorf("%d targets, want one per method", len(ts.list))
+	}
+	// The log spans 4s, plus a mean gap of 4s/3 before it repeats.
+	span := 4*time.Second + 4*time.Second/3
+	for n, want := range map[int]time.Duration{1: 0, 2: 2 * time.Second, 3: time.Second, 4: 4 * time.Second, 5: span, 6: span + 2*time.Second} {
+		if got := rp.offset(n); got != want {
+			t.Errorf("offset(%d) = %s, want %s", n, got, want)
+		}
+	}
+	if tgt, path := rp.request(6); tgt.method != "POST" || tgt.url != "http://localhost:3000" || path != "/b" {
+		t.Errorf("request 6 is %s %s%s, want the second entry again", tgt.method, tgt.url, path)
+	}
+
+	entries[2].at = time.Time{}
+	if _, _, err := newReplay(entries, "http://localhost:3000", true); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("newReplay() = %v, want an error for the line without a timestamp", err)
+	}
+}
@@ -0,0 +1,37 @@
+package loadtest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodeBody wraps r in a decompressor matching the response's
+// Content-Encoding. Unknown or absent encodings, and bodies whose gzip or
+// zlib header cannot be read, are returned as is.
+func decodeBody(resp *http.Response, r io.Reader) io.Reader {
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		if zr, err := gzip.NewReader(r); err == nil {
+			return zr
+		}
+	case "deflate":
+		if zr, err := zlib.NewReader(r); err == nil {
+			return zr
+		}
+	}
+	return r
+}
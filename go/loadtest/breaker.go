@@ -0,0 +1,49 @@
+package loadtest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// breaker aborts a run once the failure rate over the last requests exceeds
+// ABORT_ERROR_RATE, so a target that is clearly down is not kept under load.
+// It is safe for concurrent use.
+type breaker struct {
+	threshold float64
+	abort     context.CancelFunc
+	tripped   atomic.Bool
+
+	mu       sync.Mutex
+	window   []bool // ring of the most recent outcomes, true for a failure
+	next     int
+	filled   bool
+	failures int
+}
+
+func newBreaker(window int, threshold float64, abort context.CancelFunc) *breaker {
+	return &breaker{threshold: threshold, abort: abort, window: make([]bool, window)}
+}
+
+// record adds the outcome of one request and trips the breaker if the
+// window is full and its failure rate is above the threshold.
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	if b.window[b.next] {
+		b.failures--
+	}
+	b.window[b.next] = !ok
+	if !ok {
+		b.failures++
+	}
+	b.next++
+	if b.next == len(b.window) {
+		b.next, b.filled = 0, true
+	}
+	trip := b.filled && float64(b.failures)/float64(len(b.window)) > b.threshold
+	b.mu.Unlock()
+
+	if trip && b.tripped.CompareAndSwap(false, true) {
+		b.abort()
+	}
+}
@@ -0,0 +1,79 @@
+package loadtest
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// captureBodyLimit is how much of a response body is kept in CAPTURE_FILE.
+const captureBodyLimit = 4096
+
+// captureWriter appends sampled exchanges to CAPTURE_FILE for debugging:
+// the request as sent and the response status, headers and the start of its
+// body. Only a fraction of requests is captured, so a mutex is enough.
+type captureWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	err error // first write error
+}
+
+func newCaptureWriter(path string) (*captureWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &captureWriter{f: f, buf: bufio.NewWriter(f)}, nil
+}
+
+// captured reports whether request n (1-based) is sampled at rate (0-1).
+// Sampled requests are spread evenly, so exactly rate of them are captured
+// and SEED plays no part in which.
+func captured(n int, rate float64) bool {
+	return math.Floor(float64(n)*rate) > math.Floor(float64(n-1)*rate)
+}
+
+// truncateBody cuts body to captureBodyLimit, noting how much was dropped.
+func truncateBody(body []byte) []byte {
+	if len(body) <= captureBodyLimit {
+		return body
+	}
+	return fmt.Appendf(body[:captureBodyLimit:captureBodyLimit], "\n[... %d more bytes]", len(body)-captureBodyLimit)
+}
+
+// write appends one captured exchange.
+func (c *captureWriter) write(threadID, reqNum int, res result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.buf, "=== %s | thread %d | request %d ===\n", res.start.UTC().Format(time.RFC3339Nano), threadID, reqNum)
+	c.buf.Write(res.dumpReq)
+	switch {
+	case res.dumpResp != nil:
+		fmt.Fprintf(c.buf, "\n--- response after %.2f ms ---\n", float64(res.latency.Microseconds())/1000)
+		c.buf.Write(res.dumpResp)
+	case res.err != nil:
+		fmt.Fprintf(c.buf, "\n--- %s: %v ---\n", res.errMsg, res.err)
+	}
+	_, err := c.buf.WriteString("\n\n")
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// close flushes and closes the file.
+func (c *captureWriter) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.err
+	if ferr := c.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,493 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config holds the settings for a load test run. Start from DefaultConfig and
+// override what you need; the zero value of an optional field leaves its
+// feature off. The command-line tool fills every field from a flag or the
+// matching environment variable, which the README documents.
+type Config struct {
+	Concurrency         int // workers pulling from the shared job queue
+	TotalRequests       int // requests to issue in total, ignored in duration mode
+	TargetURL           string
+	TargetURLs          string // comma-separated, overrides TargetURL when set
+	TargetURLA          string // with TargetURLB, compare two targets instead, see RunAB
+	TargetURLB          string
+	AuthToken           string
+	UserAgent           string // empty omits the header; DefaultConfig identifies the tester
+	IdempotencyKey      bool   // send a fresh UUID per request in IdempotencyHeader
+	IdempotencyHeader   string
+	AuthTokensFile      string // one bearer token per line, rotated per request; overrides AuthToken
+	AuthTokensRandom    bool   // pick tokens at random instead of round-robin
+	BasicAuthUser       string
+	BasicAuthPass       string
+	HMACSecret          string // signs every request, see signRequest; empty disables signing
+	HMACHeader          string // header the signature is sent in
+	HMACTimestampHeader string // header the signed timestamp is sent in
+	HMACAlgorithm       string // "sha1", "sha256", "sha384" or "sha512"
+	HMACEncoding        string // "hex" or "base64"
+	Method              string
+	Percentiles         []float64
+	Duration            time.Duration
+	TargetRPS           float64
+	RateSchedule        []RateStep // rates to step through in order, overriding TargetRPS
+	RequestTimeout      time.Duration
+	DrainTimeout        time.Duration // how long requests in flight at the end may take to complete, 0 waits for them
+	OutputFormat        string
+	RampUp              time.Duration
+	Headers             map[string]string
+	HeaderPoolFile      string // YAML map of header names to values, one picked at random per request
+	KeepAlive           bool
+	MaxIdleConnsPerHost int
+	MetricsAddr         string
+	DashboardAddr       string // listen address of the live web dashboard, empty disables it
+	StatsdAddr          string // host:port of a statsd server the final report is pushed to, empty disables it
+	OTLPEndpoint        string // OTLP/HTTP URL of an OpenTelemetry collector the final report is pushed to, empty disables it
+	MetricsPrefix       string // name prefix of the pushed metrics
+	ReportInterval      time.Duration
+	PayloadFile         string // "-" reads the payload from stdin
+	PayloadSequence     string // JSON array of bodies sent in order, cycling, instead of PayloadFile or PayloadDir
+	PayloadDir          string
+	Seed                int64 // source of every random choice, so equal seeds replay the same choices
+	ExpectBodyContains  string
+	MaxRetries          int
+	RetryBackoff        time.Duration
+	HonorRetryAfter     bool // pause a worker for the Retry-After of a 429 or 503 response
+	CSVOutput           string
+	JSONLOutput         string // one JSON object per request, richer than CSVOutput
+	ThinkTime           time.Duration
+	ThinkTimeJitter     time.Duration
+	HTTP2               bool
+	InsecureSkipVerify  bool
+	ClientCert          string // PEM client certificate for mutual TLS, with ClientKey
+	ClientKey           string
+	CACert              string  // PEM root certificate trusted in addition to the system roots
+	MaxFailureRate      float64 // negative disables the check
+	LatencySLAs         []LatencySLA
+	WarmupRequests      int
+	WarmupDuration      time.Duration
+	Progress            bool
+	Quiet               bool
+	NoBanner            bool // leave out the start-up banner and decorative lines, for scripting
+	PprofAddr           string
+	CompressRequest     bool
+	DecompressResponse  bool
+	MaxResponseBytes    int64  // response body bytes read, after decompression; 0 reads every body in full
+	OversizeResponse    string // what a longer body counts as: "truncate" (read up to the limit) or "fail"
+	ProxyURL            string // overrides HTTP_PROXY/HTTPS_PROXY/NO_PROXY when set
+	FollowRedirects     bool   // false records 3xx responses as they are
+	MaxRedirects        int    // redirects followed before the request fails
+	SetupURL            string // request sent once before the load, empty disables it
+	SetupMethod         string
+	SetupPayload        string
+	SetupExtract        string // JSON path of the value to extract, empty uses the whole body
+	SetupHeader         string // "Key: Value" added to every request, {{.Setup}} is the extracted value
+	SuccessCodes        map[int]bool
+	MaxRequests         int // caps the total number of requests in any mode, 0 disables it
+	TraceTiming         bool
+	ContentType         string
+	MultipartFile       string // file uploaded when ContentType is multipart/form-data
+	MultipartField      string
+	LatencyBuckets      []time.Duration   // ascending bucket bounds of the latency histogram, nil disables it
+	LatencyAlgo         string            // "exact" (log-linear histogram) or "tdigest", what percentiles are computed with
+	ArrivalModel        string            // "closed" (workers loop) or "open" (requests arrive at TargetRPS)
+	Poisson             bool              // exponentially distributed inter-arrival times in the open model
+	ScenarioFile        string            // YAML file of weighted scenarios, overrides the target URLs
+	RawRequestFile      string            // complete HTTP request to replay, overrides Method, the target URLs and the payload
+	AccessLogFile       string            // access log replayed against BaseURL, once if Duration and TotalRequests are 0; overrides Method and the target URLs
+	BaseURL             string            // scheme, host and optional path prefix the logged paths are appended to
+	AccessLogTiming     bool              // keep the logged gaps between requests instead of sending them as fast as allowed
+	Protocol            string            // "http", "grpc" (unary calls to the host:port in TargetURL) or "websocket" (messages to a ws:// or wss:// TargetURL)
+	GRPCMethod          string            // package.Service/Method called with the JSON payload as its input message
+	GRPCProtoset        string            // descriptor set defining GRPCMethod, empty asks the server's reflection service
+	GRPCTLS             bool              // call the gRPC target over TLS, also implied by any TLS setting
+	WSMessagesPerConn   int               // messages a worker sends on a WebSocket connection before opening a new one, 0 for no limit
+	Mode                string            // "standalone", "agent" (serve runs for a coordinator) or "coordinator"
+	AgentAddr           string            // listen address in agent mode
+	AgentToken          string            // shared secret coordinator and agents authenticate with
+	Agents              []string          // host:port of every agent in coordinator mode
+	CookieJar           bool              // keep the cookies a worker receives and send them back
+	MaxProcs            int               // GOMAXPROCS set by the command-line tool, 0 keeps the runtime default
+	Resolve             map[string]string // "host:port" to the address dialled instead, bypassing DNS
+	UnixSocket          string            // path of a Unix socket every connection is made to instead
+	LocalAddrs          []string          // source IPs connections are made from, rotated across workers; empty lets the system choose
+	LogFormat           string            // "text" or "json" (structured per-request records through log/slog)
+	AbortErrorRate      float64           // abort once the failure rate (0-1) over the last AbortWindow requests exceeds this, 0 disables it
+	AbortWindow         int
+	PayloadSize         int    // bytes of generated body sent instead of PayloadFile, 0 disables it
+	ResponseSchema      string // JSON Schema file successful responses must match
+	MaxInflight         int    // ceiling on requests outstanding at once across workers, 0 disables it
+	TimeSeriesFile      string // JSON Lines file of per-window latency, "-" for stdout
+	TimeSeriesInterval  time.Duration
+	CaptureFile         string  // file sampled requests and responses are dumped to
+	CaptureSampleRate   float64 // fraction (0-1] of requests captured
+	DryRun              bool    // print a sample request instead of running, see DryRun
+	ResourceStats       bool    // report the tester's peak goroutines and heap usage
+	PerThreadStats      bool    // break the results down by worker
+
+	// Transport timeouts, each disabled by 0. RequestTimeout still bounds
+	// the whole request.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+
+	// With a TargetRPS, measure latency from when each request was scheduled
+	// rather than when it was sent, correcting for coordinated omission.
+	CorrectCoordinatedOmission bool
+}
+
+// LatencySLA is a response time objective checked after the run: the given
+// latency percentile must not exceed Max.
+type LatencySLA struct {
+	Percentile float64 // 0-100, e.g. 99 for p99
+	Max        time.Duration
+}
+
+// reportedPercentiles returns Percentiles plus any percentile an SLA checks,
+// so that every SLA can be judged from the report.
+func (c Config) reportedPercentiles() []float64 {
+	ps := c.Percentiles
+	for _, s := range c.LatencySLAs {
+		if !slices.Contains(ps, s.Percentile) {
+			ps = append(slices.Clip(ps), s.Percentile)
+		}
+	}
+	return ps
+}
+
+// DefaultLatencyBuckets are the histogram bounds used when LATENCY_BUCKETS is unset.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// openModel reports whether requests arrive at a fixed rate instead of as
+// fast as the workers can send them.
+func (c Config) openModel() bool {
+	return c.ArrivalModel == "open"
+}
+
+// grpc reports whether the run calls a gRPC method instead of sending HTTP
+// requests.
+func (c Config) grpc() bool {
+	return c.Protocol == "grpc"
+}
+
+// websocket reports whether the run sends messages over WebSocket
+// connections instead of HTTP requests.
+func (c Config) websocket() bool {
+	return c.Protocol == "websocket"
+}
+
+// basicAuth reports whether HTTP Basic credentials are configured.
+func (c Config) basicAuth() bool {
+	return c.BasicAuthUser != "" && c.BasicAuthPass != ""
+}
+
+// Version identifies the build in the default User-Agent. Release builds set
+// it with -ldflags "-X loadtester_go/loadtest.Version=1.2.3".
+var Version = "dev"
+
+// DefaultConfig returns the configuration the command-line tool uses when
+// nothing is set, except that TargetURL is left empty.
+func DefaultConfig() Config {
+	return Config{
+		Concurrency:         20,
+		TotalRequests:       1000,
+		Method:              http.MethodPost,
+		UserAgent:           "load-tester/" + Version,
+		IdempotencyHeader:   "Idempotency-Key",
+		HMACHeader:          "X-Signature",
+		HMACTimestampHeader: "X-Timestamp",
+		HMACAlgorithm:       "sha256",
+		HMACEncoding:        "hex",
+		Percentiles:         []float64{50, 90, 95, 99},
+		RequestTimeout:      30 * time.Second,
+		OutputFormat:        "text",
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		PayloadFile:         "payload.json",
+		RetryBackoff:        100 * time.Millisecond,
+		MaxFailureRate:      -1,
+		FollowRedirects:     true,
+		MaxRedirects:        10,
+		SetupMethod:         http.MethodPost,
+		SuccessCodes:        map[int]bool{http.StatusOK: true, http.StatusCreated: true},
+		ContentType:         "application/json",
+		MultipartField:      "file",
+		ArrivalModel:        "closed",
+		Protocol:            "http",
+		OversizeResponse:    "truncate",
+		MetricsPrefix:       "loadtester",
+		Mode:                "standalone",
+		AgentAddr:           "127.0.0.1:7070",
+		LogFormat:           "text",
+		AbortWindow:         100,
+		TimeSeriesInterval:  time.Second,
+		LatencyAlgo:         "exact",
+		CaptureSampleRate:   1,
+
+		DialTimeout:         30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// validMethods is the set of methods accepted for Method and SetupMethod.
+var validMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Validate reports the first setting that would keep a run from starting.
+func (c Config) Validate() error {
+	switch c.Mode {
+	case "", "standalone":
+	case "agent":
+		if c.AgentToken == "" {
+			return errors.New("agent mode needs a shared secret (AGENT_TOKEN), which coordinators must also set")
+		}
+		return nil // every run brings its own configuration, checked when it arrives
+	case "coordinator":
+		if len(c.Agents) == 0 {
+			return errors.New("coordinator mode needs at least one agent (AGENTS)")
+		}
+		if c.AgentToken == "" {
+			return errors.New("coordinator mode needs the shared secret of the agents (AGENT_TOKEN)")
+		}
+		if err := checkAgentConfig(c); err != nil {
+			return err
+		}
+		if c.Concurrency < len(c.Agents) {
+			return fmt.Errorf("concurrency %d is lower than the number of agents (%d)", c.Concurrency, len(c.Agents))
+		}
+	default:
+		return fmt.Errorf("mode must be standalone, agent or coordinator, got %q", c.Mode)
+	}
+	if c.abMode() {
+		switch {
+		case c.TargetURLA == "" || c.TargetURLB == "":
+			return errors.New("an A/B comparison needs both TARGET_URL_A and TARGET_URL_B")
+		case c.Mode == "coordinator":
+			return errors.New("an A/B comparison cannot be distributed across agents")
+		case c.ScenarioFile != "":
+			return errors.New("an A/B comparison cannot use a scenario file")
+		case c.Concurrency < 2:
+			return fmt.Errorf("an A/B comparison needs a concurrency of at least 2, got %d", c.Concurrency)
+		}
+	}
+	if c.MaxProcs < 0 {
+		return fmt.Errorf("max procs must not be negative, got %d", c.MaxProcs)
+	}
+	if c.TargetURL == "" && c.TargetURLs == "" && c.ScenarioFile == "" && c.RawRequestFile == "" && c.AccessLogFile == "" {
+		return errors.New("no target URL configured")
+	}
+	if c.RawRequestFile != "" && c.ScenarioFile != "" {
+		return errors.New("a raw request file and a scenario file cannot be used together")
+	}
+	switch c.Protocol {
+	case "", "http":
+	case "grpc":
+		switch {
+		case c.GRPCMethod == "":
+			return errors.New("PROTOCOL=grpc needs the method to call (GRPC_METHOD)")
+		case c.TargetURLs != "" || c.ScenarioFile != "" || c.RawRequestFile != "" || c.AccessLogFile != "" || c.abMode():
+			return errors.New("PROTOCOL=grpc calls the single host:port in TARGET_URL and cannot use TARGET_URLS, scenarios, raw requests, access logs or an A/B comparison")
+		case strings.Contains(c.TargetURL, "://"):
+			return fmt.Errorf("a gRPC target is a host:port, got %q", c.TargetURL)
+		case c.CompressRequest || (c.ContentType != "" && c.ContentType != "application/json"):
+			return errors.New("gRPC payloads are JSON messages and cannot be compressed or form-encoded")
+		}
+	case "websocket":
+		switch {
+		case c.TargetURLs != "" || c.ScenarioFile != "" || c.RawRequestFile != "" || c.AccessLogFile != "" || c.abMode():
+			return errors.New("PROTOCOL=websocket connects to the single URL in TARGET_URL and cannot use TARGET_URLS, scenarios, raw requests, access logs or an A/B comparison")
+		case !strings.HasPrefix(c.TargetURL, "ws://") && !strings.HasPrefix(c.TargetURL, "wss://"):
+			return fmt.Errorf("a WebSocket target is a ws:// or wss:// URL, got %q", c.TargetURL)
+		case c.CompressRequest || c.HTTP2:
+			return errors.New("WebSocket messages cannot be compressed, and the handshake is always HTTP/1.1")
+		case c.WSMessagesPerConn < 0:
+			return fmt.Errorf("messages per WebSocket connection must not be negative, got %d", c.WSMessagesPerConn)
+		}
+	default:
+		return fmt.Errorf("protocol must be http, grpc or websocket, got %q", c.Protocol)
+	}
+	if c.AccessLogFile != "" {
+		switch {
+		case c.BaseURL == "":
+			return errors.New("replaying an access log needs a BASE_URL to send the requests to")
+		case c.ScenarioFile != "" || c.RawRequestFile != "":
+			return errors.New("an access log cannot be replayed together with a scenario or raw request file")
+		case c.abMode():
+			return errors.New("an A/B comparison cannot replay an access log")
+		case c.Mode == "coordinator":
+			return errors.New("an access log replay cannot be distributed across agents")
+		case c.AccessLogTiming && c.openModel():
+			return errors.New("ACCESS_LOG_TIMING already paces the requests and cannot be combined with the open model")
+		}
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", c.Concurrency)
+	}
+	if len(c.SuccessCodes) == 0 {
+		return errors.New("no success status codes configured")
+	}
+	switch c.ArrivalModel {
+	case "", "closed":
+	case "open":
+		if c.TargetRPS <= 0 && len(c.RateSchedule) == 0 {
+			return errors.New("the open arrival model needs a target rate (TARGET_RPS or RATE_SCHEDULE)")
+		}
+	default:
+		return fmt.Errorf("arrival model must be closed or open, got %q", c.ArrivalModel)
+	}
+	if c.Poisson && !c.openModel() {
+		return errors.New("Poisson arrivals need the open arrival model")
+	}
+	if c.CorrectCoordinatedOmission && len(c.RateSchedule) > 0 {
+		return errors.New("coordinated omission correction needs a fixed rate and cannot follow RATE_SCHEDULE")
+	}
+	if c.CorrectCoordinatedOmission && c.TargetRPS <= 0 {
+		return errors.New("coordinated omission correction needs a target rate (TARGET_RPS)")
+	}
+	for _, s := range c.RateSchedule {
+		if s.Duration <= 0 || s.RPS <= 0 {
+			return fmt.Errorf("rate schedule steps need a positive duration and rate, got %s:%g", s.Duration, s.RPS)
+		}
+	}
+	if c.CaptureFile != "" && (c.CaptureSampleRate <= 0 || c.CaptureSampleRate > 1) {
+		return fmt.Errorf("capture sample rate must be above 0 and at most 1, got %g", c.CaptureSampleRate)
+	}
+	if c.TimeSeriesFile != "" && c.TimeSeriesInterval <= 0 {
+		return fmt.Errorf("time series interval must be positive, got %s", c.TimeSeriesInterval)
+	}
+	switch c.LatencyAlgo {
+	case "", "exact", "tdigest":
+	default:
+		return fmt.Errorf("latency algorithm must be exact or tdigest, got %q", c.LatencyAlgo)
+	}
+	if c.TimeSeriesFile == "-" && c.OutputFormat == "json" {
+		return errors.New("TIMESERIES_FILE=- and OUTPUT_FORMAT=json would both write to stdout; send the time series to a file instead")
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"drain", c.DrainTimeout},
+		{"dial", c.DialTimeout},
+		{"TLS handshake", c.TLSHandshakeTimeout},
+		{"response header", c.ResponseHeaderTimeout},
+		{"idle connection", c.IdleConnTimeout},
+	} {
+		if t.d < 0 {
+			return fmt.Errorf("%s timeout must not be negative, got %s", t.name, t.d)
+		}
+	}
+	for _, s := range c.LatencySLAs {
+		if s.Percentile <= 0 || s.Percentile > 100 || s.Max <= 0 {
+			return fmt.Errorf("latency SLA needs a percentile in (0, 100] and a positive limit, got p%g <= %s", s.Percentile, s.Max)
+		}
+	}
+	if c.IdempotencyKey && c.IdempotencyHeader == "" {
+		return errors.New("idempotency keys need a header name (IDEMPOTENCY_HEADER_NAME)")
+	}
+	if c.HMACSecret != "" {
+		switch {
+		case c.HMACHeader == "" || c.HMACTimestampHeader == "":
+			return errors.New("request signing needs a signature and a timestamp header (HMAC_HEADER, HMAC_TIMESTAMP_HEADER)")
+		case hmacHashes[c.HMACAlgorithm] == nil:
+			return fmt.Errorf("HMAC algorithm must be sha1, sha256, sha384 or sha512, got %q", c.HMACAlgorithm)
+		case c.HMACEncoding != "hex" && c.HMACEncoding != "base64":
+			return fmt.Errorf("HMAC encoding must be hex or base64, got %q", c.HMACEncoding)
+		}
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("a client certificate needs both CLIENT_CERT and CLIENT_KEY")
+	}
+	if c.FollowRedirects && c.MaxRedirects < 1 {
+		return fmt.Errorf("max redirects must be at least 1 when following redirects, got %d", c.MaxRedirects)
+	}
+	if c.MaxInflight < 0 {
+		return fmt.Errorf("max in-flight requests must not be negative, got %d", c.MaxInflight)
+	}
+	if c.MaxResponseBytes < 0 {
+		return fmt.Errorf("response size limit must not be negative, got %d", c.MaxResponseBytes)
+	}
+	if c.OversizeResponse != "" && c.OversizeResponse != "truncate" && c.OversizeResponse != "fail" {
+		return fmt.Errorf("oversize response mode must be truncate or fail, got %q", c.OversizeResponse)
+	}
+	if c.PayloadSize < 0 {
+		return fmt.Errorf("payload size must not be negative, got %d", c.PayloadSize)
+	}
+	if c.AbortErrorRate > 0 && c.AbortWindow < 1 {
+		return fmt.Errorf("abort window must be at least 1 request, got %d", c.AbortWindow)
+	}
+	if c.LogFormat != "" && c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("log format must be text or json, got %q", c.LogFormat)
+	}
+	if !validMethods[c.Method] {
+		return fmt.Errorf("HTTP method %q is not supported", c.Method)
+	}
+	if c.Method == http.MethodHead && c.ScenarioFile == "" && c.RawRequestFile == "" && (c.ExpectBodyContains != "" || c.ResponseSchema != "") {
+		return errors.New("HEAD responses have no body to check with EXPECT_BODY_CONTAINS or RESPONSE_SCHEMA")
+	}
+	if _, _, err := mime.ParseMediaType(c.ContentType); err != nil {
+		return fmt.Errorf("content type %q is not a valid media type: %w", c.ContentType, err)
+	}
+	if c.SetupURL != "" {
+		if !validMethods[c.SetupMethod] {
+			return fmt.Errorf("setup method %q is not supported", c.SetupMethod)
+		}
+		if key, _, ok := strings.Cut(c.SetupHeader, ":"); c.SetupHeader != "" && (!ok || strings.TrimSpace(key) == "") {
+			return fmt.Errorf("setup header must look like \"Key: Value\", got %q", c.SetupHeader)
+		}
+	}
+	for _, a := range c.LocalAddrs {
+		if net.ParseIP(a) == nil {
+			return fmt.Errorf("local address must be an IP address, got %q", a)
+		}
+	}
+	if c.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddr); err != nil {
+			return fmt.Errorf("statsd address must be host:port, got %q", c.StatsdAddr)
+		}
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("OTLP endpoint must be an http:// or https:// URL, such as http://collector:4318, got %q", c.OTLPEndpoint)
+		}
+	}
+	if (c.StatsdAddr != "" || c.OTLPEndpoint != "") && c.MetricsPrefix == "" {
+		return errors.New("pushed metrics need a name prefix (METRICS_PREFIX)")
+	}
+	if c.ProxyURL != "" {
+		if u, err := url.Parse(c.ProxyURL); err != nil || u.Host == "" {
+			return fmt.Errorf("proxy URL must be absolute, such as http://proxy:3128, got %q", c.ProxyURL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package loadtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string // substring of the error, empty for a valid config
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"no target", func(c *Config) { c.TargetURL = "" }, "no target URL"},
+		{"scenario without target URL", func(c *Config) { c.TargetURL, c.ScenarioFile = "", "scenarios.yaml" }, ""},
+		{"unknown mode", func(c *Config) { c.Mode = "cluster" }, "mode must be"},
+		{"agent without token", func(c *Config) { c.Mode = "agent" }, "AGENT_TOKEN"},
+		{"agent ignores the rest", func(c *Config) { c.Mode, c.AgentToken, c.TargetURL = "agent", "s3cret", "" }, ""},
+		{"coordinator without agents", func(c *Config) { c.Mode, c.AgentToken = "coordinator", "s3cret" }, "at least one agent"},
+		{"coordinator without token", func(c *Config) { c.Mode, c.Agents = "coordinator", []string{"a:7070"} }, "AGENT_TOKEN"},
+		{"coordinator", func(c *Config) {
+			c.Mode, c.Agents, c.AgentToken = "coordinator", []string{"a:7070", "b:7070"}, "s3cret"
+		}, ""},
+		{"coordinator with a CSV file", func(c *Config) {
+			c.Mode, c.Agents, c.AgentToken, c.CSVOutput = "coordinator", []string{"a:7070"}, "s3cret", "out.csv"
+		}, "CSV_OUTPUT"},
+		{"coordinator with a setup request", func(c *Config) {
+			c.Mode, c.Agents, c.AgentToken, c.SetupURL = "coordinator", []string{"a:7070"}, "s3cret", "http://localhost:3000/login"
+		}, "SETUP_URL"},
+		{"coordinator with a proxy", func(c *Config) {
+			c.Mode, c.Agents, c.AgentToken, c.ProxyURL = "coordinator", []string{"a:7070"}, "s3cret", "http://proxy:8080"
+		}, "PROXY_URL"},
+		{"coordinator with fewer workers than agents", func(c *Config) {
+			c.Mode, c.Agents, c.AgentToken, c.Concurrency = "coordinator", []string{"a:7070", "b:7070"}, "s3cret", 1
+		}, "lower than the number of agents"},
+		{"zero concurrency", func(c *Config) { c.Concurrency = 0 }, "concurrency must be at least 1"},
+		{"no success codes", func(c *Config) { c.SuccessCodes = nil }, "no success status codes"},
+		{"grpc without method", func(c *Config) { c.Protocol, c.TargetURL = "grpc", "localhost:50051" }, "GRPC_METHOD"},
+		{"grpc with a URL", func(c *Config) { c.Protocol, c.GRPCMethod = "grpc", "pkg.Svc/Call" }, "host:port"},
+		{"grpc", func(c *Config) { c.Protocol, c.GRPCMethod, c.TargetURL = "grpc", "pkg.Svc/Call", "localhost:50051" }, ""},
+		{"websocket to an http URL", func(c *Config) { c.Protocol = "websocket" }, "ws:// or wss://"},
+		{"websocket", func(c *Config) { c.Protocol, c.TargetURL = "websocket", "ws://localhost:3000/ws" }, ""},
+		{"unknown protocol", func(c *Config) { c.Protocol = "ftp" }, "protocol must be"},
+		{"open model without rate", func(c *Config) { c.ArrivalModel = "open" }, "needs a target rate"},
+		{"open model", func(c *Config) { c.ArrivalModel, c.TargetRPS = "open", 100 }, ""},
+		{"poisson with closed model", func(c *Config) { c.Poisson = true }, "open arrival model"},
+		{"access log without base URL", func(c *Config) { c.AccessLogFile = "access.log" }, "BASE_URL"},
+		{"time series and JSON on stdout", func(c *Config) { c.TimeSeriesFile, c.OutputFormat = "-", "json" }, "both write to stdout"},
+		{"time series on stdout with text", func(c *Config) { c.TimeSeriesFile = "-" }, ""},
+		{"time series to a file with JSON", func(c *Config) { c.TimeSeriesFile, c.OutputFormat = "series.jsonl", "json" }, ""},
+		{"zero time series interval", func(c *Config) { c.TimeSeriesFile, c.TimeSeriesInterval = "series.jsonl", 0 }, "interval must be positive"},
+		{"tdigest", func(c *Config) { c.LatencyAlgo = "tdigest" }, ""},
+		{"unknown latency algorithm", func(c *Config) { c.LatencyAlgo = "hdr" }, "exact or tdigest"},
+		{"negative dial timeout", func(c *Config) { c.DialTimeout = -time.Second }, "dial timeout"},
+		{"SLA above p100", func(c *Config) { c.LatencySLAs = []LatencySLA{{Percentile: 101, Max: time.Second}} }, "latency SLA"},
+		{"client cert without key", func(c *Config) { c.ClientCert = "client.pem" }, "CLIENT_KEY"},
+		{"unknown HMAC algorithm", func(c *Config) { c.HMACSecret, c.HMACAlgorithm = "key", "md5" }, "HMAC algorithm"},
+		{"unknown method", func(c *Config) { c.Method = "FETCH" }, "not supported"},
+		{"HEAD with a body check", func(c *Config) { c.Method, c.ExpectBodyContains = "HEAD", "ok" }, "HEAD responses"},
+		{"bad content type", func(c *Config) { c.ContentType = "application/json; charset" }, "not a valid media type"},
+		{"local address that is not an IP", func(c *Config) { c.LocalAddrs = []string{"eth0"} }, "IP address"},
+		{"statsd without port", func(c *Config) { c.StatsdAddr = "localhost" }, "host:port"},
+		{"OTLP endpoint without scheme", func(c *Config) { c.OTLPEndpoint = "localhost:4318" }, "OTLP"},
+		{"OTLP endpoint", func(c *Config) { c.OTLPEndpoint = "http://localhost:4318" }, ""},
+		{"A/B with one target", func(c *Config) { c.TargetURLA = "http://a" }, "both TARGET_URL_A and TARGET_URL_B"},
+		{"A/B", func(c *Config) { c.TargetURLA, c.TargetURLB = "http://a", "http://b" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			c.TargetURL = "http://localhost:3000/api/foo"
+			tt.modify(&c)
+			err := c.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want no error", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("Validate() = nil, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package loadtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+// csvRow is one line of the CSV_OUTPUT file.
+type csvRow struct {
+	thread   int
+	reqNum   int
+	start    time.Time
+	status   int
+	duration time.Duration
+	err      string
+}
+
+// csvWriter streams per-request rows to a file. Workers hand rows over a
+// buffered channel and a single goroutine does the writing, so workers never
+// contend on a lock for file I/O.
+type csvWriter struct {
+	f    *os.File
+	rows chan csvRow
+	done chan error
+}
+
+func newCSVWriter(path string) (*csvWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &csvWriter{f: f, rows: make(chan csvRow, 4096), done: make(chan error, 1)}
+	go w.loop()
+	return w, nil
+}
+
+func (w *csvWriter) loop() {
+	buf := bufio.NewWriterSize(w.f, 64*1024)
+	cw := csv.NewWriter(buf)
+	cw.Write([]string{"thread", "request_num", "timestamp", "status", "duration_ms", "error"})
+	for row := range w.rows {
+		cw.Write([]string{
+			strconv.Itoa(row.thread),
+			strconv.Itoa(row.reqNum),
+			row.start.Format(time.RFC3339Nano),
+			strconv.Itoa(row.status),
+			strconv.FormatFloat(float64(row.duration.Nanoseconds())/1_000_000.0, 'f', 3, 64),
+			row.err,
+		})
+	}
+	cw.Flush()
+	err := cw.Error()
+	if ferr := buf.Flush(); err == nil {
+		err = ferr
+	}
+	w.done <- err
+}
+
+// write queues a row; it only blocks if the writer falls far behind.
+func (w *csvWriter) write(row csvRow) {
+	w.rows <- row
+}
+
+// close drains pending rows, flushes and closes the file.
+func (w *csvWriter) close() error {
+	close(w.rows)
+	err := <-w.done
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
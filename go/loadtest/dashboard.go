@@ -0,0 +1,149 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// dashboardSnapshot is the body of the dashboard's /stats endpoint: the
+// run's counters at the time of the request. The page derives the current
+// rate from the change in Total between two polls.
+type dashboardSnapshot struct {
+	ElapsedS    float64            `json:"elapsed_s"`
+	Total       uint64             `json:"total"`
+	Success     uint64             `json:"success"`
+	Failure     uint64             `json:"failure"`
+	Inflight    int64              `json:"inflight"`
+	RPS         float64            `json:"rps"` // average since the start
+	AvgMs       float64            `json:"avg_ms"`
+	Percentiles map[string]float64 `json:"percentiles_ms"`
+	Failures    map[string]uint64  `json:"failures"`
+	StatusCodes map[int]uint64     `json:"status_codes"`
+}
+
+// snapshot reads the counters of st, with latency percentiles at ps.
+func (s *stats) snapshot(ps []float64, elapsed time.Duration) dashboardSnapshot {
+	snap := dashboardSnapshot{
+		ElapsedS:    elapsed.Seconds(),
+		Success:     atomic.LoadUint64(&s.success),
+		Failure:     atomic.LoadUint64(&s.failure),
+		Inflight:    atomic.LoadInt64(&s.inflight),
+		Percentiles: latencyPercentiles(ps, s.sketch),
+		Failures:    make(map[string]uint64),
+		StatusCodes: s.statusCodes(),
+	}
+	snap.Total = snap.Success + snap.Failure
+	if elapsed > 0 {
+		snap.RPS = float64(snap.Total) / elapsed.Seconds()
+	}
+	if timed := atomic.LoadUint64(&s.timed); timed > 0 {
+		snap.AvgMs = float64(atomic.LoadUint64(&s.totalNs)) / float64(timed) / 1_000_000.0
+	}
+	for c := range numFailureCategories {
+		if n := atomic.LoadUint64(&s.failures[c]); n > 0 {
+			snap.Failures[failureKeys[c]] = n
+		}
+	}
+	return snap
+}
+
+// startDashboard serves a live view of st on addr: an HTML page at / that
+// polls the JSON counters at /stats every second. It returns a function that
+// shuts the server down.
+func startDashboard(addr string, st *stats, ps []float64, start time.Time) func() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboardPage))
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st.snapshot(ps, time.Since(start)))
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: dashboard on %s stopped: %v", addr, err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Warning: dashboard shutdown: %v", err)
+		}
+	}
+}
+
+// dashboardPage is the page served at / by startDashboard. It has no
+// dependencies, so it works without internet access.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>load-tester</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.tiles { display: flex; flex-wrap: wrap; gap: 1em; }
+.tile { border: 1px solid #ccc; border-radius: 6px; padding: 0.8em 1.2em; min-width: 9em; }
+.tile .v { font-size: 1.8em; font-weight: bold; }
+.tile .l { color: #666; }
+table { border-collapse: collapse; margin-top: 1.5em; }
+td, th { padding: 0.2em 1em 0.2em 0; text-align: left; }
+#status { color: #666; margin-top: 1.5em; }
+</style>
+</head>
+<body>
+<h1>load-tester</h1>
+<div class="tiles" id="tiles"></div>
+<table id="details"></table>
+<div id="status">connecting...</div>
+<script>
+let last = null;
+function tile(label, value) {
+  return '<div class="tile"><div class="v">' + value + '</div><div class="l">' + label + '</div></div>';
+}
+function rows(title, counts) {
+  const keys = Object.keys(counts || {});
+  if (keys.length === 0) return '';
+  return '<tr><th colspan="2">' + title + '</th></tr>' +
+    keys.map(k => '<tr><td>' + k + '</td><td>' + counts[k] + '</td></tr>').join('');
+}
+async function poll() {
+  try {
+    const s = await (await fetch('stats')).json();
+    let current = s.rps;
+    if (last && s.elapsed_s > last.elapsed_s) {
+      current = (s.total - last.total) / (s.elapsed_s - last.elapsed_s);
+    }
+    last = s;
+    let html = tile('current RPS', current.toFixed(1)) + tile('average RPS', s.rps.toFixed(1)) +
+      tile('requests', s.total) + tile('failures', s.failure) + tile('in flight', s.inflight) +
+      tile('avg ms', s.avg_ms.toFixed(2));
+    for (const [label, ms] of Object.entries(s.percentiles_ms)) {
+      html += tile(label + ' ms', ms.toFixed(2));
+    }
+    document.getElementById('tiles').innerHTML = html;
+    document.getElementById('details').innerHTML = rows('Failures', s.failures) + rows('Status codes', s.status_codes);
+    document.getElementById('status').textContent = 'running for ' + s.elapsed_s.toFixed(0) + 's, updated ' + new Date().toLocaleTimeString();
+  } catch (e) {
+    document.getElementById('status').textContent = 'run finished or unreachable';
+  }
+}
+poll();
+setInterval(poll, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,621 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A distributed run spreads one test over several hosts. Each agent
+// (MODE=agent) serves a small HTTP control API; the coordinator
+// (MODE=coordinator) hands every agent its share of the load, waits for all
+// of them and merges their reports into one.
+//
+// The control API has two endpoints:
+//
+//	POST /run   run the JSON-encoded Config in the body and respond with the result
+//	POST /stop  interrupt the current run, which then responds with partial results
+//
+// Every request must carry the shared AGENT_TOKEN as a bearer token. As the
+// coordinator may not be on the agent host, an agent does not open
+// listeners, write files, dial Unix sockets or send requests other than the
+// load for it, and only reads files inside its working directory, see
+// checkAgentConfig.
+
+// agentResult is the response to POST /run: the agent's report plus the
+// latency state the coordinator needs to merge percentiles exactly.
+type agentResult struct {
+	Report    Report         `json:"report"`
+	Histogram map[int]uint64 `json:"histogram"`        // non-empty buckets by index
+	Digest    *tdigestState  `json:"digest,omitempty"` // instead of Histogram with LATENCY_ALGO=tdigest
+	Variance  [3]float64     `json:"variance"`         // Welford count, mean and M2
+
+	HandshakeHistogram map[int]uint64 `json:"handshake_histogram,omitempty"` // see PROTOCOL=websocket
+}
+
+// ServeAgent serves the agent control API on addr until ctx is cancelled,
+// to coordinators that authenticate with token. An agent runs one test at a
+// time and answers 409 Conflict while busy.
+func ServeAgent(ctx context.Context, addr, token string) error {
+	if token == "" {
+		return errors.New("the agent control API needs a shared secret (AGENT_TOKEN)")
+	}
+	var (
+		mu   sync.Mutex
+		stop context.CancelFunc // interrupts the current run, nil when idle
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /run", func(w http.ResponseWriter, r *http.Request) {
+		var cfg Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, fmt.Sprintf("invalid configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+		cfg.Mode, cfg.Agents = "standalone", nil
+		cfg.PprofAddr, cfg.MetricsAddr, cfg.DashboardAddr = "", "", ""
+		err := checkAgentConfig(cfg)
+		if err == nil && cfg.ScenarioFile != "" {
+			err = checkScenarioPayloads(cfg.ScenarioFile)
+		}
+		if err != nil {
+			log.Printf("Warning: refused run from coordinator %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		// The run also stops if the coordinator goes away.
+		runCtx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		mu.Lock()
+		if stop != nil {
+			mu.Unlock()
+			http.Error(w, "agent is already running a test", http.StatusConflict)
+			return
+		}
+		stop = cancel
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			stop = nil
+			mu.Unlock()
+		}()
+
+		log.Printf("Run requested by coordinator %s", r.RemoteAddr)
+		report, err := Run(runCtx, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		LogReport(cfg, report)
+		res := agentResult{
+			Report:   report,
+			Variance: [3]float64{report.variance.n, report.variance.mean, report.variance.m2},
+		}
+		switch s := report.sketch.(type) {
+		case *histogram:
+			res.Histogram = s.sparse()
+		case *tdigest:
+			state := s.state()
+			res.Digest = &state
+		}
+		if report.Handshakes != nil {
+			res.HandshakeHistogram = report.Handshakes.hist.sparse()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Printf("Warning: could not send result to coordinator %s: %v", r.RemoteAddr, err)
+		}
+	})
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if stop != nil {
+			log.Printf("Stop requested by coordinator %s", r.RemoteAddr)
+			stop()
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	want := []byte("Bearer " + token)
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			log.Printf("Warning: rejected %s %s from %s without the right AGENT_TOKEN", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "missing or wrong AGENT_TOKEN", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// RunDistributed runs cfg across cfg.Agents and returns their merged report.
+// Concurrency, TotalRequests, MaxRequests and the target rate are divided
+// between the agents as evenly as possible; every other setting, including
+// Duration, is sent to each agent unchanged, so payload, scenario and raw
+// request files must exist on every agent host, inside the directory it runs
+// in. Cancelling ctx interrupts all agents and the report covers what they
+// completed. An error is returned if any agent could not run its share.
+func RunDistributed(ctx context.Context, cfg Config) (Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return Report{}, err
+	}
+	if !cfg.NoBanner {
+		log.Printf("🚀 Coordinating load test across %d agents...", len(cfg.Agents))
+	}
+
+	// Agents are stopped through the control API rather than by dropping
+	// their connection, so that they still send their partial results. If
+	// one agent fails the others are stopped too, as the run is lost anyway.
+	runCtx := context.WithoutCancel(ctx)
+	var stopOnce sync.Once
+	stopAll := func() {
+		stopOnce.Do(func() {
+			for _, addr := range cfg.Agents {
+				go stopAgent(addr, cfg.AgentToken)
+			}
+		})
+	}
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopAll()
+		case <-stopped:
+		}
+	}()
+
+	results := make([]agentResult, len(cfg.Agents))
+	errs := make([]error, len(cfg.Agents))
+	var wg sync.WaitGroup
+	for i, addr := range cfg.Agents {
+		share := agentShare(cfg, i)
+		volume := fmt.Sprintf("%d requests", share.TotalRequests)
+		if share.Duration > 0 {
+			volume = "for " + share.Duration.String()
+		}
+		if share.TargetRPS > 0 {
+			volume += fmt.Sprintf(" at %g RPS", share.TargetRPS)
+		}
+		if !cfg.NoBanner {
+			log.Printf("  - %s: concurrency %d, %s", addr, share.Concurrency, volume)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if results[i], errs[i] = runOnAgent(runCtx, addr, cfg.AgentToken, share); errs[i] != nil {
+				stopAll()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return Report{}, err
+	}
+	return mergeReports(cfg, results)
+}
+
+// agentShare returns the part of cfg that agent i runs.
+func agentShare(cfg Config, i int) Config {
+	n := len(cfg.Agents)
+	share := splitConfig(cfg, n, i)
+	share.Mode, share.Agents = "standalone", nil
+	share.AgentToken = "" // sent in the Authorization header instead
+	// Offset by the agent's first worker, so that no two workers of the run
+	// share a seed.
+	share.Seed = cfg.Seed + int64(i*(cfg.Concurrency/n)+min(i, cfg.Concurrency%n))
+	return share
+}
+
+// splitConfig returns the i-th of n near-equal parts of the load in cfg:
+// workers, request counts, rate and in-flight limit are divided up.
+func splitConfig(cfg Config, n, i int) Config {
+	share := cfg
+	share.Concurrency = splitEven(cfg.Concurrency, n, i)
+	share.TotalRequests = splitEven(cfg.TotalRequests, n, i)
+	if cfg.MaxRequests > 0 {
+		share.MaxRequests = max(splitEven(cfg.MaxRequests, n, i), 1) // 0 would lift the cap
+	}
+	share.TargetRPS = cfg.TargetRPS / float64(n)
+	if len(cfg.RateSchedule) > 0 {
+		share.RateSchedule = make([]RateStep, len(cfg.RateSchedule))
+		for j, s := range cfg.RateSchedule {
+			share.RateSchedule[j] = RateStep{Duration: s.Duration, RPS: s.RPS / float64(n)}
+		}
+	}
+	if cfg.MaxInflight > 0 {
+		share.MaxInflight = max(splitEven(cfg.MaxInflight, n, i), 1)
+	}
+	return share
+}
+
+// splitEven returns the i-th of n near-equal parts of total.
+func splitEven(total, n, i int) int {
+	part := total / n
+	if i < total%n {
+		part++
+	}
+	return part
+}
+
+// agentURL turns an AGENTS entry into the base URL of its control API.
+func agentURL(addr string) string {
+	if strings.Contains(addr, "://") {
+		return strings.TrimSuffix(addr, "/")
+	}
+	return "http://" + addr
+}
+
+func runOnAgent(ctx context.Context, addr, token string, cfg Config) (agentResult, error) {
+	body, err := json.Marshal(cfg)
+	if err != nil {
+		return agentResult{}, fmt.Errorf("agent %s: cannot encode configuration: %w", addr, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agentURL(addr)+"/run", bytes.NewReader(body))
+	if err != nil {
+		return agentResult{}, fmt.Errorf("agent %s: %w", addr, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return agentResult{}, fmt.Errorf("agent %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return agentResult{}, fmt.Errorf("agent %s: %s: %s", addr, resp.Status, bytes.TrimSpace(msg))
+	}
+	var res agentResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return agentResult{}, fmt.Errorf("agent %s: invalid result: %w", addr, err)
+	}
+	return res, nil
+}
+
+func stopAgent(addr, token string) {
+	req, err := http.NewRequest(http.MethodPost, agentURL(addr)+"/stop", nil)
+	if err != nil {
+		log.Printf("Warning: could not stop agent %s: %v", addr, err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Warning: could not stop agent %s: %v", addr, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// checkAgentConfig refuses the settings of cfg that would let a coordinator
+// reach beyond the load it asks the agent running it for: files are only
+// read by relative paths that stay inside the agent's working directory,
+// including the payloads of a scenario file, results are only sent back,
+// never written on the agent host, and requests only go to the target.
+// Validate applies the same rules up front in coordinator mode, except for
+// scenario payloads, which need the file.
+func checkAgentConfig(cfg Config) error {
+	written := []struct{ name, path string }{
+		{"CSV_OUTPUT", cfg.CSVOutput},
+		{"JSONL_OUTPUT", cfg.JSONLOutput},
+		{"CAPTURE_FILE", cfg.CaptureFile},
+		{"TIMESERIES_FILE", cfg.TimeSeriesFile},
+		{"UNIX_SOCKET", cfg.UnixSocket},
+	}
+	for _, f := range written {
+		if f.path != "" {
+			return fmt.Errorf("%s cannot be used in a distributed run, as agents do not write files or dial Unix sockets for a coordinator", f.name)
+		}
+	}
+	sent := []struct{ name, url string }{
+		{"SETUP_URL", cfg.SetupURL},
+		{"PROXY_URL", cfg.ProxyURL},
+	}
+	for _, f := range sent {
+		if f.url != "" {
+			return fmt.Errorf("%s cannot be used in a distributed run, as agents only send requests to the target for a coordinator", f.name)
+		}
+	}
+	if cfg.PayloadFile == "-" {
+		return errors.New("a distributed run cannot read the payload from stdin (PAYLOAD_FILE=-)")
+	}
+	read := []struct{ name, path string }{
+		{"PAYLOAD_FILE", cfg.PayloadFile},
+		{"PAYLOAD_DIR", cfg.PayloadDir},
+		{"SCENARIO_FILE", cfg.ScenarioFile},
+		{"RAW_REQUEST_FILE", cfg.RawRequestFile},
+		{"ACCESS_LOG_FILE", cfg.AccessLogFile},
+		{"AUTH_TOKENS_FILE", cfg.AuthTokensFile},
+		{"HEADER_POOL_FILE", cfg.HeaderPoolFile},
+		{"MULTIPART_FILE", cfg.MultipartFile},
+		{"RESPONSE_SCHEMA", cfg.ResponseSchema},
+		{"GRPC_PROTOSET", cfg.GRPCProtoset},
+		{"CLIENT_CERT", cfg.ClientCert},
+		{"CLIENT_KEY", cfg.ClientKey},
+		{"CA_CERT", cfg.CACert},
+	}
+	for _, f := range read {
+		if f.path != "" && !filepath.IsLocal(f.path) {
+			return fmt.Errorf("in a distributed run %s must be a relative path inside the agent's working directory, got %q", f.name, f.path)
+		}
+	}
+	return nil
+}
+
+// checkScenarioPayloads applies checkAgentConfig to the payloads of the
+// scenario file at path.
+func checkScenarioPayloads(path string) error {
+	file, err := readScenarioFile(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range file.Scenarios {
+		if s.Payload != "" && !filepath.IsLocal(s.payloadPath(path)) {
+			return fmt.Errorf("in a distributed run scenario payloads must stay inside the agent's working directory, got %q", s.Payload)
+		}
+	}
+	return nil
+}
+
+// mergeReports combines the agents' results into one report. Counters are
+// summed and percentiles come from the merged histograms; the run lasted as
+// long as the slowest agent. Latency averages are weighted by each agent's
+// timed requests, timing averages by its request count.
+func mergeReports(cfg Config, results []agentResult) (Report, error) {
+	r := Report{
+		Seed:        cfg.Seed,
+		Model:       "closed",
+		Failures:    make(map[string]uint64),
+		Protocols:   make(map[string]uint64),
+		StatusCodes: make(map[int]uint64),
+		TargetRPS:   cfg.TargetRPS,
+		MaxInflight: cfg.MaxInflight,
+		RampUpMs:    float64(cfg.RampUp.Milliseconds()),
+	}
+	var (
+		hist   *histogram
+		digest *tdigest
+	)
+	if cfg.LatencyAlgo == "tdigest" {
+		digest = newTDigest()
+		r.sketch = digest
+	} else {
+		hist = &histogram{}
+		r.sketch = hist
+	}
+	if cfg.openModel() {
+		r.Model = "open"
+	}
+	r.COCorrected = cfg.CorrectCoordinatedOmission
+	var (
+		responses uint64
+		timing    = make(map[string]float64)
+		targetIdx = make(map[string]int)
+		tokenIdx  = make(map[string]int)
+	)
+	for i, res := range results {
+		a := res.Report
+		r.DurationMs = max(r.DurationMs, a.DurationMs)
+		r.Interrupted = r.Interrupted || a.Interrupted
+		r.CapReached = r.CapReached || a.CapReached
+		r.Aborted = r.Aborted || a.Aborted
+		r.HeadOnly = a.HeadOnly // every agent runs the same targets
+		if a.Timed > 0 {
+			if r.Timed == 0 || a.Latency.Min < r.Latency.Min {
+				r.Latency.Min = a.Latency.Min
+			}
+			r.Latency.Max = max(r.Latency.Max, a.Latency.Max)
+			r.Latency.Avg += a.Latency.Avg * float64(a.Timed)
+		}
+		r.Timed += a.Timed
+		r.Total += a.Total
+		r.Success += a.Success
+		r.Failure += a.Failure
+		r.Retries += a.Retries
+		r.Warmup += a.Warmup
+		r.Late += a.Late
+		r.PeakInflight += a.PeakInflight // agents peak independently, so this is an upper bound
+		r.Bytes += a.Bytes
+		r.WireBytes += a.WireBytes
+		r.ConnsNew += a.ConnsNew
+		r.ConnsReused += a.ConnsReused
+		r.Redirected += a.Redirected
+		r.RedirectHops += a.RedirectHops
+		r.Abandoned += a.Abandoned
+		r.Oversized += a.Oversized
+		if f := a.FirstFailure; f != nil {
+			// Each agent numbers its requests from 1, so the merged request
+			// is the earliest any agent failed at.
+			if r.FirstFailure == nil {
+				r.FirstFailure = &FirstFailReport{Request: f.Request, WorkerMin: f.WorkerMin}
+			}
+			mf := r.FirstFailure
+			mf.Request = min(mf.Request, f.Request)
+			mf.WorkerMin = min(mf.WorkerMin, f.WorkerMin)
+			mf.WorkerMax = max(mf.WorkerMax, f.WorkerMax)
+			mf.Workers += f.Workers
+		}
+		if h := a.Handshakes; h != nil {
+			if r.Handshakes == nil {
+				r.Handshakes = &HandshakeReport{hist: &histogram{}}
+			}
+			mh := r.Handshakes
+			if h.Opened > 0 {
+				if mh.Opened == 0 || h.Latency.Min < mh.Latency.Min {
+					mh.Latency.Min = h.Latency.Min
+				}
+				mh.Latency.Max = max(mh.Latency.Max, h.Latency.Max)
+				mh.Latency.Avg += h.Latency.Avg * float64(h.Opened)
+			}
+			mh.Opened += h.Opened
+			mh.Failed += h.Failed
+			if err := mh.hist.add(res.HandshakeHistogram); err != nil {
+				return Report{}, fmt.Errorf("invalid result from agent: %w", err)
+			}
+		}
+		if ra := a.RetryAfter; ra != nil {
+			if r.RetryAfter == nil {
+				r.RetryAfter = &RetryAfterReport{}
+			}
+			r.RetryAfter.Waits += ra.Waits
+			r.RetryAfter.WaitedMs += ra.WaitedMs
+		}
+		if s := a.Sequence; s != nil {
+			// Each agent replays the whole sequence on its own.
+			if r.Sequence == nil {
+				r.Sequence = &SequenceReport{Length: s.Length}
+			}
+			r.Sequence.Sent += s.Sent
+			r.Sequence.Cycles += s.Cycles
+		}
+		if a.Resources != nil {
+			// Each agent is a separate process, so the busiest one is
+			// what shows whether the testers were a bottleneck.
+			if r.Resources == nil || a.Resources.PeakHeapBytes > r.Resources.PeakHeapBytes {
+				r.Resources = a.Resources
+			}
+		}
+		addCounts(r.Failures, a.Failures)
+		addCounts(r.Protocols, a.Protocols)
+		addCounts(r.StatusCodes, a.StatusCodes)
+		if len(a.GRPCCodes) > 0 {
+			if r.GRPCCodes == nil {
+				r.GRPCCodes = make(map[string]uint64)
+			}
+			addCounts(r.GRPCCodes, a.GRPCCodes)
+		}
+		for _, n := range a.StatusCodes {
+			responses += n
+		}
+		for name, avg := range a.Timing {
+			timing[name] += avg * float64(a.Total)
+		}
+		switch {
+		case digest != nil && res.Digest != nil:
+			digest.add(*res.Digest)
+		case hist != nil && res.Digest == nil:
+			if err := hist.add(res.Histogram); err != nil {
+				return Report{}, fmt.Errorf("invalid result from agent: %w", err)
+			}
+		default:
+			return Report{}, errors.New("invalid result from agent: latency state does not match LATENCY_ALGO")
+		}
+		r.variance.merge(welford{n: res.Variance[0], mean: res.Variance[1], m2: res.Variance[2]})
+
+		for _, t := range a.Targets {
+			key := t.Name + " " + t.URL
+			j, ok := targetIdx[key]
+			if !ok {
+				j = len(r.Targets)
+				targetIdx[key] = j
+				r.Targets = append(r.Targets, TargetReport{Name: t.Name, URL: t.URL})
+			}
+			mt := &r.Targets[j]
+			if t.Timed > 0 {
+				if mt.Timed == 0 || t.Latency.Min < mt.Latency.Min {
+					mt.Latency.Min = t.Latency.Min
+				}
+				mt.Latency.Max = max(mt.Latency.Max, t.Latency.Max)
+				mt.Latency.Avg += t.Latency.Avg * float64(t.Timed)
+			}
+			mt.Timed += t.Timed
+			mt.Total += t.Total
+			mt.Success += t.Success
+			mt.Failure += t.Failure
+		}
+		for _, t := range a.Threads {
+			t.Agent = cfg.Agents[i]
+			r.Threads = append(r.Threads, t)
+		}
+		for _, t := range a.Tokens {
+			j, ok := tokenIdx[t.Label]
+			if !ok {
+				j = len(r.Tokens)
+				tokenIdx[t.Label] = j
+				r.Tokens = append(r.Tokens, TokenReport{Label: t.Label})
+			}
+			mt := &r.Tokens[j]
+			mt.Total += t.Total
+			mt.Success += t.Success
+			mt.Failure += t.Failure
+			mt.Throttled += t.Throttled
+		}
+		// Every agent follows the same schedule at its share of the rate.
+		if r.RateSteps == nil && len(a.RateSteps) > 0 {
+			r.RateSteps = make([]RateStepReport, len(a.RateSteps))
+		}
+		for j, s := range a.RateSteps {
+			if j < len(r.RateSteps) {
+				ms := &r.RateSteps[j]
+				ms.DurationMs = max(ms.DurationMs, s.DurationMs)
+				ms.TargetRPS += s.TargetRPS
+				ms.AchievedRPS += s.AchievedRPS
+				ms.Requests += s.Requests
+			}
+		}
+	}
+	if len(r.RateSteps) > 0 {
+		r.TargetRPS = meanRPS(r.RateSteps)
+	}
+
+	if r.Total > 0 {
+		r.FailureRate = float64(r.Failure) / float64(r.Total)
+	}
+	if r.Timed > 0 {
+		r.Latency.Avg /= float64(r.Timed)
+	}
+	if seconds := r.DurationMs / 1000; seconds > 0 {
+		r.RPS = float64(r.Total) / seconds
+		r.MBPerSec = float64(r.Bytes) / 1_000_000.0 / seconds
+	}
+	r.ReuseRatio = reuseRatio(r.ConnsNew, r.ConnsReused)
+	r.RateLimited = r.StatusCodes[http.StatusTooManyRequests]
+	if responses > 0 {
+		r.AvgRespSize = float64(r.Bytes) / float64(responses)
+	}
+	if cfg.TraceTiming && r.Total > 0 {
+		r.Timing = make(map[string]float64, len(timing))
+		for name, sum := range timing {
+			r.Timing[name] = sum / float64(r.Total)
+		}
+	}
+	r.Latency.StdDev = r.variance.stddev() / 1_000_000.0
+	r.Latency.Percentiles = latencyPercentiles(cfg.reportedPercentiles(), r.sketch)
+	if h := r.Handshakes; h != nil {
+		if h.Opened > 0 {
+			h.Latency.Avg /= float64(h.Opened)
+		}
+		h.Latency.Percentiles = latencyPercentiles(cfg.reportedPercentiles(), h.hist)
+	}
+	r.Histogram = histogramBuckets(cfg.LatencyBuckets, r.sketch)
+	for i := range r.Targets {
+		if t := &r.Targets[i]; t.Timed > 0 {
+			t.Latency.Avg /= float64(t.Timed)
+		}
+	}
+	return r, nil
+}
+
+// addCounts adds every count in src to dst.
+func addCounts[K comparable](dst, src map[K]uint64) {
+	for k, n := range src {
+		dst[k] += n
+	}
+}
@@ -0,0 +1,283 @@
+package loadtest
+
+import (
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// agentResultOf builds the result an agent would return after timing the
+// latencies (in nanoseconds) of its successful requests and failing the
+// given number of others.
+func agentResultOf(latencies []uint64, failures uint64) agentResult {
+	var (
+		h histogram
+		w welford
+		r = Report{DurationMs: 1000, StatusCodes: map[int]uint64{200: uint64(len(latencies))}}
+	)
+	for _, ns := range latencies {
+		h.record(ns)
+		w.add(float64(ns))
+		ms := float64(ns) / 1_000_000.0
+		if r.Timed == 0 || ms < r.Latency.Min {
+			r.Latency.Min = ms
+		}
+		r.Latency.Max = max(r.Latency.Max, ms)
+		r.Latency.Avg += ms
+		r.Timed++
+	}
+	r.Latency.Avg /= float64(r.Timed)
+	r.Success = r.Timed
+	r.Failure = failures
+	r.Total = r.Success + r.Failure
+	if failures > 0 {
+		r.StatusCodes[500] = failures
+	}
+	return agentResult{Report: r, Histogram: h.sparse(), Variance: [3]float64{w.n, w.mean, w.m2}}
+}
+
+// withDigest swaps the histogram of res, the result of agentResultOf for
+// latencies, for a t-digest of them.
+func withDigest(res agentResult, latencies []uint64) agentResult {
+	d := newTDigest()
+	for _, ns := range latencies {
+		d.record(ns)
+	}
+	state := d.state()
+	res.Histogram, res.Digest = nil, &state
+	return res
+}
+
+func TestMergeReports(t *testing.T) {
+	a := []uint64{1_000_000, 2_000_000, 3_000_000, 40_000_000}
+	b := []uint64{5_000_000, 6_000_000}
+	results := []agentResult{agentResultOf(a, 1), agentResultOf(b, 0)}
+	results[1].Report.DurationMs = 2000
+	results[0].Report.FirstFailure = &FirstFailReport{Request: 3, Workers: 1, WorkerMin: 3, WorkerMax: 3}
+	results[1].Report.FirstFailure = &FirstFailReport{Request: 7, Workers: 2, WorkerMin: 2, WorkerMax: 9}
+	results[1].Report.Threads = []ThreadReport{{Thread: 0, Total: 2}}
+
+	cfg := DefaultConfig()
+	cfg.Agents = []string{"a:7070", "b:7070"}
+	r, err := mergeReports(cfg, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != 7 || r.Success != 6 || r.Failure != 1 || r.Timed != 6 {
+		t.Errorf("total/success/failure/timed = %d/%d/%d/%d, want 7/6/1/6", r.Total, r.Success, r.Failure, r.Timed)
+	}
+	if want := 1.0 / 7; math.Abs(r.FailureRate-want) > 1e-9 {
+		t.Errorf("failure rate %g, want %g", r.FailureRate, want)
+	}
+	if r.DurationMs != 2000 || r.RPS != 3.5 {
+		t.Errorf("duration %gms and %g RPS, want the slowest agent's 2000ms and 3.5 RPS", r.DurationMs, r.RPS)
+	}
+	if r.Latency.Min != 1 || r.Latency.Max != 40 {
+		t.Errorf("latency min %g and max %g, want 1 and 40", r.Latency.Min, r.Latency.Max)
+	}
+	// Weighted by timed requests: (1+2+3+40+5+6) / 6.
+	if want := 57.0 / 6; math.Abs(r.Latency.Avg-want) > 1e-9 {
+		t.Errorf("latency avg %g, want %g", r.Latency.Avg, want)
+	}
+	if want := map[int]uint64{200: 6, 500: 1}; !maps.Equal(r.StatusCodes, want) {
+		t.Errorf("status codes %v, want %v", r.StatusCodes, want)
+	}
+
+	// Merged percentiles and deviation match one agent timing everything.
+	all := agentResultOf(append(append([]uint64(nil), a...), b...), 0)
+	single, err := mergeReports(cfg, []agentResult{all})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(r.Latency.Percentiles, single.Latency.Percentiles) {
+		t.Errorf("merged percentiles %v, want %v", r.Latency.Percentiles, single.Latency.Percentiles)
+	}
+	if math.Abs(r.Latency.StdDev-single.Latency.StdDev) > 1e-9 {
+		t.Errorf("merged standard deviation %g, want %g", r.Latency.StdDev, single.Latency.StdDev)
+	}
+	want := FirstFailReport{Request: 3, Workers: 3, WorkerMin: 2, WorkerMax: 9}
+	if r.FirstFailure == nil || *r.FirstFailure != want {
+		t.Errorf("first failure %+v, want %+v", r.FirstFailure, want)
+	}
+	if len(r.Threads) != 1 || r.Threads[0].Agent != "b:7070" {
+		t.Errorf("threads %+v, want agent b's one worker labelled with its address", r.Threads)
+	}
+}
+
+func TestMergeReportsTDigest(t *testing.T) {
+	var a, b []uint64
+	for i := uint64(1); i <= 1000; i++ {
+		a = append(a, i*1_000_000)
+		b = append(b, (i+1000)*1_000_000)
+	}
+	cfg := DefaultConfig()
+	cfg.Agents = []string{"a:7070", "b:7070"}
+	cfg.LatencyAlgo = "tdigest"
+	cfg.Percentiles = []float64{50, 99, 100}
+	r, err := mergeReports(cfg, []agentResult{withDigest(agentResultOf(a, 0), a), withDigest(agentResultOf(b, 0), b)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for label, want := range map[string]float64{"p50": 1000, "p99": 1980} {
+		if got := r.Latency.Percentiles[label]; math.Abs(got-want) > 0.005*2000 {
+			t.Errorf("%s = %gms, want about %gms", label, got, want)
+		}
+	}
+	if got := r.Latency.Percentiles["p100"]; got != 2000 {
+		t.Errorf("p100 = %gms, want the maximum 2000ms", got)
+	}
+}
+
+func TestMergeReportsLatencyAlgoMismatch(t *testing.T) {
+	latencies := []uint64{1_000_000}
+	cfg := DefaultConfig()
+	cfg.Agents = []string{"a:7070"}
+	if _, err := mergeReports(cfg, []agentResult{withDigest(agentResultOf(latencies, 0), latencies)}); err == nil {
+		t.Error("a t-digest was merged into a histogram")
+	}
+	cfg.LatencyAlgo = "tdigest"
+	if _, err := mergeReports(cfg, []agentResult{agentResultOf(latencies, 0)}); err == nil {
+		t.Error("a histogram was merged into a t-digest")
+	}
+}
+
+func TestSplitConfig(t *testing.T) {
+	tests := []struct {
+		name                               string
+		concurrency, total, maxRequests, n int
+	}{
+		{"even", 20, 1000, 0, 4},
+		{"remainder", 7, 100, 10, 3},
+		{"fewer requests than agents", 5, 2, 2, 5},
+		{"one agent", 3, 17, 4, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Concurrency, cfg.TotalRequests, cfg.MaxRequests, cfg.TargetRPS = tt.concurrency, tt.total, tt.maxRequests, 100
+			var workers, requests int
+			for i := 0; i < tt.n; i++ {
+				share := splitConfig(cfg, tt.n, i)
+				workers += share.Concurrency
+				requests += share.TotalRequests
+				if share.TotalRequests < tt.total/tt.n || share.TotalRequests > tt.total/tt.n+1 {
+					t.Errorf("agent %d gets %d of %d requests, not a near-equal share", i, share.TotalRequests, tt.total)
+				}
+				if tt.maxRequests > 0 && share.MaxRequests < 1 {
+					t.Errorf("agent %d has MAX_REQUESTS %d, which would lift the cap", i, share.MaxRequests)
+				}
+				if share.TargetRPS != 100/float64(tt.n) {
+					t.Errorf("agent %d targets %g RPS, want %g", i, share.TargetRPS, 100/float64(tt.n))
+				}
+			}
+			if workers != tt.concurrency || requests != tt.total {
+				t.Errorf("shares add up to %d workers and %d requests, want %d and %d", workers, requests, tt.concurrency, tt.total)
+			}
+		})
+	}
+}
+
+func TestAgentShare(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mode, cfg.Agents, cfg.AgentToken = "coordinator", []string{"a:7070", "b:7070", "c:7070"}, "s3cret"
+	cfg.Concurrency, cfg.Seed = 8, 42
+	// Each agent's seed is offset by the workers of the agents before it,
+	// so that no two workers of the run share a seed.
+	next := cfg.Seed
+	for i := range cfg.Agents {
+		share := agentShare(cfg, i)
+		if share.Mode != "standalone" || share.Agents != nil {
+			t.Errorf("agent %d runs mode %q with agents %v, want a standalone run", i, share.Mode, share.Agents)
+		}
+		if share.AgentToken != "" {
+			t.Errorf("agent %d is sent the shared secret in its configuration", i)
+		}
+		if share.Seed != next {
+			t.Errorf("agent %d has seed %d, want %d", i, share.Seed, next)
+		}
+		next += int64(share.Concurrency)
+	}
+}
+
+func TestCheckAgentConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"relative payload", func(c *Config) { c.PayloadFile = "payloads/order.json" }, ""},
+		{"absolute payload", func(c *Config) { c.PayloadFile = "/etc/passwd" }, "PAYLOAD_FILE"},
+		{"payload outside the directory", func(c *Config) { c.PayloadFile = "../secret.json" }, "PAYLOAD_FILE"},
+		{"payload from stdin", func(c *Config) { c.PayloadFile = "-" }, "stdin"},
+		{"tokens outside the directory", func(c *Config) { c.AuthTokensFile = "../tokens.txt" }, "AUTH_TOKENS_FILE"},
+		{"absolute header pool", func(c *Config) { c.HeaderPoolFile = "/etc/headers.json" }, "HEADER_POOL_FILE"},
+		{"absolute CA certificate", func(c *Config) { c.CACert = "/etc/ssl/ca.pem" }, "CA_CERT"},
+		{"client key outside the directory", func(c *Config) { c.ClientKey = "certs/../../key.pem" }, "CLIENT_KEY"},
+		{"CSV output", func(c *Config) { c.CSVOutput = "out.csv" }, "CSV_OUTPUT"},
+		{"time series", func(c *Config) { c.TimeSeriesFile = "series.jsonl" }, "TIMESERIES_FILE"},
+		{"capture file", func(c *Config) { c.CaptureFile = "capture.txt" }, "CAPTURE_FILE"},
+		{"JSON Lines output", func(c *Config) { c.JSONLOutput = "out.jsonl" }, "JSONL_OUTPUT"},
+		{"Unix socket", func(c *Config) { c.UnixSocket = "/run/app.sock" }, "UNIX_SOCKET"},
+		{"setup request", func(c *Config) { c.SetupURL = "http://localhost:3000/login" }, "SETUP_URL"},
+		{"proxy", func(c *Config) { c.ProxyURL = "http://169.254.169.254" }, "PROXY_URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tt.modify(&c)
+			err := checkAgentConfig(c)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkAgentConfig() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("checkAgentConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckScenarioPayloads(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{"beside the scenario file", "order.json", false},
+		{"in a subdirectory", "payloads/order.json", false},
+		{"in the working directory", "../order.json", false},
+		{"absolute", "/etc/passwd", true},
+		{"outside the working directory", "../../secret.json", true},
+	}
+	// Scenario payloads are relative to the scenario file, which the agent
+	// reads from scenarios/ in its working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "scenarios"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("scenarios", "scenarios.yaml")
+			spec := "scenarios:\n  - name: order\n    url: http://localhost:3000/order\n    payload: " + tt.payload + "\n"
+			if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := checkScenarioPayloads(path)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("checkScenarioPayloads() = %v, want an error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
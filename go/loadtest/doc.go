@@ -0,0 +1,14 @@
+// Package loadtest generates HTTP load against one or more targets and
+// summarises the results. It is the engine behind the load-tester command and
+// can be embedded in other Go programs, such as test harnesses:
+//
+//	cfg := loadtest.DefaultConfig()
+//	cfg.TargetURL = "http://localhost:3000/api/foo"
+//	cfg.Concurrency = 50
+//	report, err := loadtest.Run(ctx, cfg)
+//
+// The stable API is Config, DefaultConfig, Config.Validate, Run, Report (with
+// TargetReport and LatencyReport), LogReport, ThresholdsPassed and
+// PushMetrics. Progress
+// and per-request lines are written through the standard log package.
+package loadtest
@@ -0,0 +1,80 @@
+package loadtest
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drain bounds how long a run waits for its outstanding requests once it is
+// over, see DRAIN_TIMEOUT. The run is over when ctx ends it (DURATION or
+// ABORT_ERROR_RATE) or a worker takes the final job. From then on no new
+// request is started, and those in flight get the timeout to complete and be
+// recorded. Any still outstanding after it are cancelled and counted as
+// abandoned rather than as failures. An interrupt cancels them straight away.
+type drain struct {
+	last      int // number of the final job, 0 if only ctx ends the run
+	over      chan struct{}
+	once      sync.Once
+	reqCtx    context.Context // the context of every request, cancelled on abandon or interrupt
+	abandon   context.CancelFunc
+	abandoned int64
+}
+
+// newDrain derives the requests' context from parent, which only an
+// interrupt cancels.
+func newDrain(parent context.Context, cfg Config) *drain {
+	d := &drain{over: make(chan struct{})}
+	d.reqCtx, d.abandon = context.WithCancel(parent)
+	switch {
+	case cfg.Duration == 0 && cfg.MaxRequests > 0:
+		d.last = min(cfg.TotalRequests, cfg.MaxRequests)
+	case cfg.Duration == 0:
+		d.last = cfg.TotalRequests
+	default:
+		d.last = cfg.MaxRequests
+	}
+	return d
+}
+
+// taken notes that a worker took job n.
+func (d *drain) taken(n int) {
+	if n == d.last {
+		d.once.Do(func() { close(d.over) })
+	}
+}
+
+// cancelled reports whether a request that failed with err was cut short
+// by the drain timeout or an interrupt.
+func (d *drain) cancelled(err error) bool {
+	return err != nil && d.reqCtx.Err() != nil
+}
+
+// wait returns once finished is closed, which the workers do when they have
+// all exited. Once the run is over the requests in st.inflight get timeout
+// to complete before they are abandoned.
+func (d *drain) wait(ctx context.Context, finished <-chan struct{}, timeout time.Duration, st *stats, logDrain bool) {
+	select {
+	case <-finished:
+		return
+	case <-ctx.Done():
+	case <-d.over:
+	}
+	if d.reqCtx.Err() != nil {
+		<-finished // interrupted, the requests in flight are already cancelled
+		return
+	}
+	if n := atomic.LoadInt64(&st.inflight); logDrain && n > 0 {
+		log.Printf("Draining %d in-flight requests (up to %s)...", n, timeout)
+	}
+	select {
+	case <-finished:
+		return
+	case <-time.After(timeout):
+	}
+	d.abandoned = atomic.LoadInt64(&st.inflight)
+	d.abandon()
+	<-finished
+}
@@ -0,0 +1,83 @@
+package loadtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// dryRunPreviewLimit is how much of a payload DryRun prints.
+const dryRunPreviewLimit = 1024
+
+// DryRun loads and checks cfg like Run would, then writes one sample request
+// per target to w, with templates rendered, instead of sending any traffic.
+// The setup request is not sent either, so {{.Setup}} renders empty.
+func DryRun(cfg Config, w io.Writer) error {
+	cfg, rs, err := prepare(cfg)
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	vars := templateVars{rng: rng, counter: &rs.counter}
+	if cfg.SetupURL != "" {
+		fmt.Fprintf(w, "Setup request %s %s would run first; {{.Setup}} is left empty below.\n\n", cfg.SetupMethod, cfg.SetupURL)
+	}
+
+	var bodyBuf bytes.Buffer
+	for _, tgt := range rs.targets.list {
+		payloads := rs.payloads
+		if tgt.payloads != nil {
+			payloads = tgt.payloads
+		}
+		var body []byte
+		if methodHasBody(tgt.requestMethod(cfg)) && len(payloads) > 0 {
+			body = payloads[0].render(vars, &bodyBuf)
+		}
+		var token string
+		if rs.tokens != nil {
+			token = rs.tokens.list[0].value
+		}
+		var key string
+		if cfg.IdempotencyKey {
+			key = uniqueUUID()
+		}
+		var pooled http.Header
+		if rs.headers != nil {
+			pooled = rs.headers.pick(rng)
+		}
+		req, err := newRequest(cfg, tgt, tgt.render(vars), body, token, key, pooled)
+		if err != nil {
+			return fmt.Errorf("cannot build request for %s: %w", tgt.url, err)
+		}
+
+		if tgt.name != "" {
+			fmt.Fprintf(w, "=== scenario %s ===\n", tgt.name)
+		} else {
+			fmt.Fprintf(w, "=== %s ===\n", tgt.url)
+		}
+		w.Write(dumpRequest(req, false))
+		switch {
+		case body == nil:
+		case cfg.CompressRequest || !utf8.Valid(body):
+			fmt.Fprintf(w, "[%d bytes of binary body]\n", len(body))
+		case len(body) > dryRunPreviewLimit:
+			fmt.Fprintf(w, "%s\n[... %d more bytes]\n", body[:dryRunPreviewLimit], len(body)-dryRunPreviewLimit)
+		default:
+			fmt.Fprintf(w, "%s\n", bytes.TrimRight(body, "\n"))
+		}
+		if len(payloads) > 1 && body != nil {
+			fmt.Fprintf(w, "[first of %d payloads, picked at random per request]\n", len(payloads))
+		}
+		if pooled != nil {
+			fmt.Fprintf(w, "[%s picked at random per request from %s]\n", strings.Join(rs.headers.names, ", "), cfg.HeaderPoolFile)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "Dry run: configuration is valid, no requests were sent.")
+	return nil
+}
@@ -0,0 +1,101 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// failureCategory classifies why a request was counted as a failure.
+type failureCategory int
+
+const (
+	failDNS failureCategory = iota
+	failConnect
+	failTimeout
+	failTLS
+	failHTTP4xx
+	failHTTP5xx
+	failHTTPOther
+	failBodyMismatch
+	failIncompleteBody
+	failSchemaViolation
+	failOversized
+	failOther
+	numFailureCategories
+)
+
+var failureNames = [numFailureCategories]string{
+	failDNS:             "DNS errors",
+	failConnect:         "Connection errors",
+	failTimeout:         "Timeouts",
+	failTLS:             "TLS errors",
+	failHTTP4xx:         "HTTP 4xx",
+	failHTTP5xx:         "HTTP 5xx",
+	failHTTPOther:       "Other HTTP status",
+	failBodyMismatch:    "Body mismatch",
+	failIncompleteBody:  "Incomplete body",
+	failSchemaViolation: "Schema violation",
+	failOversized:       "Oversized body",
+	failOther:           "Other errors",
+}
+
+// failureKeys are the identifiers used for each category in the JSON report.
+var failureKeys = [numFailureCategories]string{
+	failDNS:             "dns",
+	failConnect:         "connect",
+	failTimeout:         "timeout",
+	failTLS:             "tls",
+	failHTTP4xx:         "http_4xx",
+	failHTTP5xx:         "http_5xx",
+	failHTTPOther:       "http_other",
+	failBodyMismatch:    "body_mismatch",
+	failIncompleteBody:  "incomplete_body",
+	failSchemaViolation: "schema_violation",
+	failOversized:       "oversized_body",
+	failOther:           "other",
+}
+
+// classifyError maps a transport error returned by http.Client.Do to a failure category.
+func classifyError(err error) failureCategory {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return failDNS
+	}
+
+	var (
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		verifyErr  *tls.CertificateVerificationError
+		authErr    x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authErr) || errors.As(err, &hostErr) || errors.As(err, &invalidErr) {
+		return failTLS
+	}
+
+	if isTimeout(err) {
+		return failTimeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return failConnect
+	}
+	return failOther
+}
+
+// classifyStatus maps a non-success HTTP status code to a failure category.
+func classifyStatus(code int) failureCategory {
+	switch {
+	case code >= http.StatusBadRequest && code < http.StatusInternalServerError:
+		return failHTTP4xx
+	case code >= http.StatusInternalServerError && code < 600:
+		return failHTTP5xx
+	}
+	return failHTTPOther
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package loadtest
+
+// warnFileLimit does nothing on systems without RLIMIT_NOFILE.
+func warnFileLimit(Config) {}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package loadtest
+
+import (
+	"log"
+	"syscall"
+)
+
+// fdReserve is the number of file descriptors a run is assumed to need
+// besides its connections: standard streams, output files, payloads and
+// listeners such as the dashboard.
+const fdReserve = 64
+
+// warnFileLimit warns if a run of cfg likely needs more file descriptors than
+// RLIMIT_NOFILE allows, which would otherwise surface mid-run as a stream of
+// "too many open files" send errors. Every worker may hold a connection, and
+// with keep-alive off closed ones are replaced by new ones as fast as the
+// workers go. The Go runtime already raises the soft limit to the hard limit
+// at startup, but if it could not, this tries again before warning.
+func warnFileLimit(cfg Config) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return
+	}
+	need := uint64(cfg.Concurrency) + fdReserve
+	if lim.Cur >= need {
+		return
+	}
+	if lim.Max > lim.Cur {
+		raised := lim
+		raised.Cur = min(lim.Max, max(need, lim.Cur))
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err == nil {
+			log.Printf("Raised the open file limit from %d to %d for %d workers", lim.Cur, raised.Cur, cfg.Concurrency)
+			lim = raised
+		}
+	}
+	if lim.Cur < need {
+		log.Printf("Warning: %d workers need about %d open files, but the limit is %d (hard limit %d); "+
+			"expect \"too many open files\" errors. Lower CONCURRENCY or raise the limit, e.g. with ulimit -n %d",
+			cfg.Concurrency, need, lim.Cur, lim.Max, need)
+	}
+}
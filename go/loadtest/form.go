@@ -0,0 +1,89 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// parseFormPairs reads key=value pairs, one per line or separated by "&".
+// Blank lines and lines starting with "#" are skipped. Values are taken
+// literally and escaped when the body is encoded.
+func parseFormPairs(raw []byte) url.Values {
+	values := url.Values{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, pair := range strings.Split(line, "&") {
+			if key, value, _ := strings.Cut(pair, "="); key != "" {
+				values.Add(key, value)
+			}
+		}
+	}
+	return values
+}
+
+// encodeForm turns key=value pairs into an application/x-www-form-urlencoded body.
+func encodeForm(raw []byte) []byte {
+	return []byte(parseFormPairs(raw).Encode())
+}
+
+// multipartUpload is the file part of a multipart/form-data body. The
+// boundary is fixed for the run so the Content-Type header can be set once.
+type multipartUpload struct {
+	field    string
+	fileName string // empty when no MULTIPART_FILE is configured
+	data     []byte
+	boundary string
+}
+
+func newMultipartUpload(path, field string) (*multipartUpload, error) {
+	up := &multipartUpload{field: field, boundary: multipart.NewWriter(nil).Boundary()}
+	if path == "" {
+		return up, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	up.fileName = filepath.Base(path)
+	up.data = data
+	return up, nil
+}
+
+func (up *multipartUpload) contentType() string {
+	return "multipart/form-data; boundary=" + up.boundary
+}
+
+// encode builds a multipart body with the key=value pairs in raw as fields,
+// followed by the file.
+func (up *multipartUpload) encode(raw []byte) []byte {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.SetBoundary(up.boundary)
+	values := parseFormPairs(raw)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, v := range values[key] {
+			w.WriteField(key, v)
+		}
+	}
+	if up.fileName != "" {
+		part, _ := w.CreateFormFile(up.field, up.fileName)
+		part.Write(up.data)
+	}
+	w.Close()
+	return buf.Bytes()
+}
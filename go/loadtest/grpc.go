@@ -0,0 +1,316 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcStatusCodes maps gRPC status codes to the HTTP status that stands in
+// for them, following grpc-gateway, so that SUCCESS_CODES, the failure
+// categories and retries treat both protocols alike: Unavailable is
+// retried like a 503, ResourceExhausted counts as rate limited like a 429.
+var grpcStatusCodes = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// grpcMethod is the unary method a PROTOCOL=grpc run calls, with the
+// descriptors its JSON payloads are encoded and its responses decoded with.
+type grpcMethod struct {
+	desc protoreflect.MethodDescriptor
+	path string // "/package.Service/Method"
+}
+
+// loadGRPCMethod resolves GRPCMethod, "package.Service/Method" or
+// "package.Service.Method", from the descriptor set in GRPCProtoset, as
+// written by protoc --include_imports --descriptor_set_out, or else through
+// the server reflection service of the target.
+func loadGRPCMethod(cfg Config, tlsConf *tls.Config) (*grpcMethod, error) {
+	name := strings.TrimPrefix(cfg.GRPCMethod, "/")
+	i := strings.LastIndexAny(name, "/.")
+	if i <= 0 || i == len(name)-1 {
+		return nil, fmt.Errorf("gRPC method must be package.Service/Method, got %q", cfg.GRPCMethod)
+	}
+	service, method := name[:i], name[i+1:]
+
+	var (
+		files *protoregistry.Files
+		err   error
+	)
+	if cfg.GRPCProtoset != "" {
+		files, err = loadProtoset(cfg.GRPCProtoset)
+	} else {
+		files, err = reflectFiles(cfg, tlsConf, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("gRPC service %s not found: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a gRPC service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("gRPC service %s has no method %s", service, method)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("gRPC method %s/%s is streaming; only unary methods are supported", service, method)
+	}
+	return &grpcMethod{desc: md, path: "/" + service + "/" + method}, nil
+}
+
+// loadProtoset reads a binary FileDescriptorSet.
+func loadProtoset(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read gRPC descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid gRPC descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gRPC descriptor set %s (built with --include_imports?): %w", path, err)
+	}
+	return files, nil
+}
+
+// reflectFiles asks the target's reflection service for the file defining
+// service and every file it imports. Imports the server leaves out, such as
+// the well-known types, are taken from those linked into the tester.
+func reflectFiles(cfg Config, tlsConf *tls.Config, service string) (*protoregistry.Files, error) {
+	conn, err := dialGRPC(cfg, tlsConf, localAddr(cfg, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), max(cfg.RequestTimeout, 10*time.Second))
+	defer cancel()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gRPC reflection on %s: %w", cfg.TargetURL, err)
+	}
+	defer stream.CloseSend()
+
+	ask := func(req *rpb.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, errors.New(e.GetErrorMessage())
+		}
+		var out []*descriptorpb.FileDescriptorProto
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return nil, err
+			}
+			out = append(out, fd)
+		}
+		return out, nil
+	}
+
+	found, err := ask(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gRPC reflection on %s cannot resolve %s (set GRPC_PROTOSET if the server has no reflection): %w", cfg.TargetURL, service, err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	have := make(map[string]bool)
+	for len(found) > 0 {
+		fd := found[0]
+		found = found[1:]
+		if have[fd.GetName()] {
+			continue
+		}
+		have[fd.GetName()] = true
+		set.File = append(set.File, fd)
+		for _, dep := range fd.GetDependency() {
+			if have[dep] {
+				continue
+			}
+			if known, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				found = append(found, protodesc.ToFileDescriptorProto(known))
+				continue
+			}
+			more, err := ask(&rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("gRPC reflection on %s cannot resolve %s: %w", cfg.TargetURL, dep, err)
+			}
+			found = append(found, more...)
+		}
+	}
+	return protodesc.NewFiles(set)
+}
+
+// dialGRPC prepares a connection to TargetURL, a host:port, from local if it
+// is set. It is plaintext unless GRPCTLS or a TLS setting asks for TLS; the
+// connection itself is made on the first call.
+func dialGRPC(cfg Config, tlsConf *tls.Config, local net.Addr) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if cfg.GRPCTLS || tlsConf != nil {
+		if tlsConf == nil {
+			tlsConf = &tls.Config{}
+		}
+		creds = credentials.NewTLS(tlsConf)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithUserAgent(cfg.UserAgent)}
+	if local != nil {
+		dialer := &net.Dialer{Timeout: cfg.DialTimeout, LocalAddr: local}
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}))
+	}
+	conn, err := grpc.NewClient(cfg.TargetURL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gRPC target %q: %w", cfg.TargetURL, err)
+	}
+	return conn, nil
+}
+
+// checkPayload reports whether body, a JSON payload, is a valid request
+// message, so that a malformed payload file fails the run up front rather
+// than every request.
+func (g *grpcMethod) checkPayload(body []byte) error {
+	msg := dynamicpb.NewMessage(g.desc.Input())
+	if err := protojson.Unmarshal(body, msg); err != nil {
+		return fmt.Errorf("payload is not a valid %s: %w", g.desc.Input().FullName(), err)
+	}
+	return nil
+}
+
+// exchange calls the method once with payload, JSON for its input message,
+// and classifies the reply like an HTTP response, see grpcStatusCodes. The
+// response is decoded back to JSON only when EXPECT_BODY_CONTAINS or a
+// schema needs to check it.
+func (g *grpcMethod) exchange(ctx context.Context, conn *grpc.ClientConn, cfg Config, payload []byte, token string, pooled http.Header, schema *jsonschema.Schema) result {
+	in := dynamicpb.NewMessage(g.desc.Input())
+	if len(payload) > 0 {
+		if err := protojson.Unmarshal(payload, in); err != nil {
+			return result{failure: failOther, err: err, errMsg: "build error", start: time.Now()}
+		}
+	}
+	md := metadata.MD{}
+	for k, v := range cfg.Headers {
+		md.Set(k, v)
+	}
+	for k, v := range pooled {
+		md.Set(k, v...)
+	}
+	if token == "" {
+		token = cfg.AuthToken
+	}
+	if token != "" {
+		md.Set("authorization", "Bearer "+token)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	if cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	out := dynamicpb.NewMessage(g.desc.Output())
+	start := time.Now()
+	err := conn.Invoke(ctx, g.path, in, out)
+	latency := time.Since(start)
+
+	st := status.Convert(err)
+	switch {
+	case st.Code() == codes.DeadlineExceeded && ctx.Err() != nil:
+		return result{failure: failTimeout, err: err, errMsg: fmt.Sprintf("timeout after %s", cfg.RequestTimeout), start: start}
+	case st.Code() == codes.Unavailable && strings.Contains(st.Message(), "connection error"):
+		// Never reached the server, unlike an Unavailable it answered with.
+		return result{failure: failConnect, err: err, errMsg: "send error", start: start}
+	}
+	res := result{
+		status:  "gRPC " + st.Code().String(),
+		code:    grpcStatusCodes[st.Code()],
+		proto:   "HTTP/2.0", // what gRPC always runs over
+		rpc:     st.Code().String(),
+		start:   start,
+		latency: latency,
+	}
+	if res.code == 0 {
+		res.code = http.StatusInternalServerError // a code newer than this table
+	}
+	if st.Message() != "" && st.Code() != codes.OK {
+		res.status += ": " + st.Message()
+	}
+	if err == nil {
+		res.bytes = int64(proto.Size(out))
+		res.wire = res.bytes
+	}
+	switch {
+	case !cfg.SuccessCodes[res.code]:
+		res.failure = classifyStatus(res.code)
+	case cfg.ExpectBodyContains == "" && schema == nil:
+		res.ok = true
+	default:
+		body, _ := protojson.Marshal(out)
+		switch {
+		case cfg.ExpectBodyContains != "" && !strings.Contains(string(body), cfg.ExpectBodyContains):
+			res.failure = failBodyMismatch
+		case schema != nil:
+			if err := validateBody(schema, body); err != nil {
+				res.failure, res.err = failSchemaViolation, err
+				res.errMsg = fmt.Sprintf("schema violation (%s)", res.status)
+				break
+			}
+			res.ok = true
+		default:
+			res.ok = true
+		}
+	}
+	return res
+}
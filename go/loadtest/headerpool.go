@@ -0,0 +1,89 @@
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// headerPool holds the headers of HEADER_POOL_FILE, each with the values one
+// is picked from per request. Names are canonical and sorted, so that the
+// picks follow from SEED.
+type headerPool struct {
+	names  []string
+	values [][]string
+}
+
+// headerValues are the values of one header in HEADER_POOL_FILE: a list, or
+// a single scalar for a header that does not vary.
+type headerValues []string
+
+func (v *headerValues) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = headerValues{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(v))
+}
+
+// loadHeaderPool reads a YAML (or JSON) file that maps header names to lists
+// of values, such as
+//
+//	User-Agent: [curl/8.5.0, "Mozilla/5.0 (iPhone; ...)"]
+//	X-Device-Id: [d-1001, d-1002, d-1003]
+func loadHeaderPool(path string) (*headerPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read HEADER_POOL_FILE: %w", err)
+	}
+	var file map[string]headerValues
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse header pool file %s: %w", path, err)
+	}
+	if len(file) == 0 {
+		return nil, fmt.Errorf("header pool file %s defines no headers", path)
+	}
+
+	byName := make(map[string][]string, len(file))
+	for name, values := range file {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ": \t\r\n") {
+			return nil, fmt.Errorf("header pool file %s: invalid header name %q", path, name)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("header pool file %s: %s has no values", path, name)
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if _, ok := byName[canonical]; ok {
+			return nil, fmt.Errorf("header pool file %s: %s is listed twice", path, canonical)
+		}
+		byName[canonical] = []string(values)
+	}
+	pool := &headerPool{names: make([]string, 0, len(byName))}
+	for name := range byName {
+		pool.names = append(pool.names, name)
+	}
+	slices.Sort(pool.names)
+	for _, name := range pool.names {
+		pool.values = append(pool.values, byName[name])
+	}
+	return pool, nil
+}
+
+// pick chooses one value of each header for the next request.
+func (p *headerPool) pick(rng *rand.Rand) http.Header {
+	h := make(http.Header, len(p.names))
+	for i, name := range p.names {
+		values := p.values[i]
+		v := values[0]
+		if len(values) > 1 {
+			v = values[rng.Intn(len(values))]
+		}
+		h[name] = []string{v}
+	}
+	return h
+}
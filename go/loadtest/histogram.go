@@ -0,0 +1,124 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// The latency histogram is a fixed-size, HDR-style log-linear histogram: every
+// power-of-two range of nanoseconds is split into histSubBuckets linear
+// sub-buckets, which bounds the relative error of any reported percentile to
+// under 1% while using a constant amount of memory regardless of run length.
+const (
+	histSubBucketBits = 7
+	histSubBuckets    = 1 << histSubBucketBits
+	histBuckets       = (64 - histSubBucketBits + 1) * histSubBuckets
+)
+
+// histogram counts latencies into the buckets above. It is safe for
+// concurrent use.
+type histogram struct {
+	counts [histBuckets]uint64
+}
+
+// histIndex maps a duration in nanoseconds to its histogram bucket.
+func histIndex(ns uint64) int {
+	if ns < histSubBuckets {
+		return int(ns)
+	}
+	shift := bits.Len64(ns) - histSubBucketBits - 1
+	return (shift+1)*histSubBuckets + int(ns>>shift) - histSubBuckets
+}
+
+// histValue returns the midpoint, in nanoseconds, of the given bucket.
+func histValue(idx int) uint64 {
+	if idx < histSubBuckets {
+		return uint64(idx)
+	}
+	shift := idx/histSubBuckets - 1
+	lower := uint64(idx%histSubBuckets+histSubBuckets) << shift
+	return lower + (uint64(1)<<shift)/2
+}
+
+// record adds a single duration in nanoseconds.
+func (h *histogram) record(ns uint64) {
+	atomic.AddUint64(&h.counts[histIndex(ns)], 1)
+}
+
+// distribution counts the recorded latencies falling below each of the
+// ascending bounds (in nanoseconds) and above the previous one. The extra
+// last element counts everything at or above the final bound.
+func (h *histogram) distribution(bounds []uint64) []uint64 {
+	out := make([]uint64, len(bounds)+1)
+	j := 0
+	for i := range h.counts {
+		c := atomic.LoadUint64(&h.counts[i])
+		if c == 0 {
+			continue
+		}
+		v := histValue(i)
+		for j < len(bounds) && v >= bounds[j] {
+			j++
+		}
+		out[j] += c
+	}
+	return out
+}
+
+// sparse returns the non-empty buckets by index, the form in which agents
+// ship their histogram to the coordinator.
+func (h *histogram) sparse() map[int]uint64 {
+	out := make(map[int]uint64)
+	for i := range h.counts {
+		if c := atomic.LoadUint64(&h.counts[i]); c > 0 {
+			out[i] = c
+		}
+	}
+	return out
+}
+
+// add merges bucket counts produced by sparse into h. Both sides use the
+// same fixed bucket layout, so merged percentiles are as accurate as those
+// of a single histogram.
+func (h *histogram) add(counts map[int]uint64) error {
+	for i, c := range counts {
+		if i < 0 || i >= histBuckets {
+			return fmt.Errorf("histogram bucket %d out of range", i)
+		}
+		atomic.AddUint64(&h.counts[i], c)
+	}
+	return nil
+}
+
+// percentiles returns the latency in nanoseconds at each of the given
+// percentiles (0-100). All results are zero if nothing was recorded.
+func (h *histogram) percentiles(ps []float64) []uint64 {
+	counts := make([]uint64, histBuckets)
+	var total uint64
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+		total += counts[i]
+	}
+
+	out := make([]uint64, len(ps))
+	if total == 0 {
+		return out
+	}
+	for n, p := range ps {
+		rank := uint64(math.Ceil(p / 100 * float64(total)))
+		if rank == 0 {
+			rank = 1
+		}
+		var seen uint64
+		for i, c := range counts {
+			seen += c
+			if seen >= rank {
+				out[n] = histValue(i)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package loadtest
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestHistIndexRelativeError(t *testing.T) {
+	for _, ns := range []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 999_999, 1_000_000, 12_345_678, 1 << 40, math.MaxUint64 >> 1} {
+		idx := histIndex(ns)
+		if idx < 0 || idx >= histBuckets {
+			t.Fatalf("histIndex(%d) = %d, out of range", ns, idx)
+		}
+		got := histValue(idx)
+		if ns < histSubBuckets {
+			if got != ns {
+				t.Errorf("histValue(histIndex(%d)) = %d, want it exact", ns, got)
+			}
+			continue
+		}
+		if rel := math.Abs(float64(got)-float64(ns)) / float64(ns); rel >= 0.01 {
+			t.Errorf("histValue(histIndex(%d)) = %d, relative error %.4f", ns, got, rel)
+		}
+	}
+}
+
+func TestHistIndexMonotonic(t *testing.T) {
+	prev := histIndex(0)
+	for ns := uint64(1); ns < 1<<20; ns += 7 {
+		idx := histIndex(ns)
+		if idx < prev {
+			t.Fatalf("histIndex(%d) = %d, below the index of a smaller value (%d)", ns, idx, prev)
+		}
+		prev = idx
+	}
+}
+
+// exactPercentile is the nearest-rank percentile that histogram.percentiles
+// approximates.
+func exactPercentile(sorted []uint64, p float64) uint64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		gen  func() uint64
+	}{
+		{"constant", func() uint64 { return 5_000_000 }},
+		{"uniform 1-100ms", func() uint64 { return uint64(1_000_000 + rng.Int63n(99_000_000)) }},
+		{"long tail", func() uint64 { return uint64(math.Exp(rng.NormFloat64()*1.5 + 15)) }},
+	}
+	ps := []float64{0, 50, 90, 99, 99.9, 100}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h histogram
+			values := make([]uint64, 20_000)
+			for i := range values {
+				values[i] = tt.gen()
+				h.record(values[i])
+			}
+			slices.Sort(values)
+			for i, got := range h.percentiles(ps) {
+				want := exactPercentile(values, ps[i])
+				if rel := math.Abs(float64(got)-float64(want)) / float64(want); rel >= 0.01 {
+					t.Errorf("p%g = %d, want %d within 1%% (off by %.4f)", ps[i], got, want, rel)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramPercentilesEmpty(t *testing.T) {
+	var h histogram
+	for i, v := range h.percentiles([]float64{50, 99}) {
+		if v != 0 {
+			t.Errorf("percentile %d of an empty histogram = %d, want 0", i, v)
+		}
+	}
+}
+
+func TestHistogramDistribution(t *testing.T) {
+	var h histogram
+	for _, ms := range []uint64{1, 2, 2, 8, 30, 30, 30, 500} {
+		h.record(ms * 1_000_000)
+	}
+	got := h.distribution([]uint64{5_000_000, 50_000_000})
+	want := []uint64{3, 4, 1}
+	if !slices.Equal(got, want) {
+		t.Errorf("distribution = %v, want %v", got, want)
+	}
+}
+
+func TestHistogramSparseAdd(t *testing.T) {
+	var a, b, all histogram
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 5000; i++ {
+		ns := uint64(rng.Int63n(1e9))
+		all.record(ns)
+		if i%3 == 0 {
+			a.record(ns)
+		} else {
+			b.record(ns)
+		}
+	}
+	var merged histogram
+	for _, h := range []*histogram{&a, &b} {
+		if err := merged.add(h.sparse()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if merged.counts != all.counts {
+		t.Error("merging the sparse halves differs from recording everything in one histogram")
+	}
+	if err := merged.add(map[int]uint64{histBuckets: 1}); err == nil {
+		t.Error("add accepted a bucket index out of range")
+	}
+}
@@ -0,0 +1,115 @@
+package loadtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+)
+
+// jsonlRecord is one line of the JSONL_OUTPUT file: everything known about a
+// request, including the nested fields a CSV row cannot hold.
+type jsonlRecord struct {
+	Thread      int                `json:"thread"`
+	RequestNum  int                `json:"request_num"`
+	Timestamp   string             `json:"timestamp"`
+	Method      string             `json:"method"`
+	URL         string             `json:"url"`
+	Scenario    string             `json:"scenario,omitempty"`
+	Status      int                `json:"status,omitempty"`
+	Proto       string             `json:"proto,omitempty"`
+	DurationMs  float64            `json:"duration_ms"`
+	Bytes       int64              `json:"bytes"`
+	Success     bool               `json:"success"`
+	Failure     string             `json:"failure,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Retries     int                `json:"retries"`
+	ConnReused  bool               `json:"connection_reused"`
+	Timing      map[string]float64 `json:"timing_ms,omitempty"`
+	RespHeaders http.Header        `json:"response_headers,omitempty"`
+}
+
+// newJSONLRecord describes the final attempt of a request.
+func newJSONLRecord(cfg Config, threadID, reqNum int, tgt *target, url string, retries int, res result) jsonlRecord {
+	rec := jsonlRecord{
+		Thread:      threadID,
+		RequestNum:  reqNum,
+		Timestamp:   res.start.Format(time.RFC3339Nano),
+		Method:      tgt.requestMethod(cfg),
+		URL:         url,
+		Scenario:    tgt.name,
+		Status:      res.code,
+		Proto:       res.proto,
+		DurationMs:  float64(res.latency.Nanoseconds()) / 1_000_000.0,
+		Bytes:       res.bytes,
+		Success:     res.ok,
+		Retries:     retries,
+		ConnReused:  res.reused,
+		RespHeaders: res.header,
+	}
+	if !res.ok {
+		rec.Failure = failureKeys[res.failure]
+	}
+	if res.err != nil {
+		rec.Error = res.err.Error()
+	}
+	if cfg.TraceTiming && res.status != "" {
+		rec.Timing = make(map[string]float64, numPhases)
+		for i, name := range phaseNames {
+			if d := res.phases[i]; d > 0 {
+				rec.Timing[name] = float64(d.Nanoseconds()) / 1_000_000.0
+			}
+		}
+	}
+	return rec
+}
+
+// jsonlWriter streams one JSON object per request to a file. Like csvWriter,
+// workers hand records over a buffered channel to a single writing
+// goroutine, so they never contend on a lock for file I/O.
+type jsonlWriter struct {
+	f       *os.File
+	records chan jsonlRecord
+	done    chan error
+}
+
+func newJSONLWriter(path string) (*jsonlWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &jsonlWriter{f: f, records: make(chan jsonlRecord, 4096), done: make(chan error, 1)}
+	go w.loop()
+	return w, nil
+}
+
+func (w *jsonlWriter) loop() {
+	buf := bufio.NewWriterSize(w.f, 64*1024)
+	enc := json.NewEncoder(buf)
+	var err error
+	for rec := range w.records {
+		if eerr := enc.Encode(rec); err == nil {
+			err = eerr
+		}
+	}
+	if ferr := buf.Flush(); err == nil {
+		err = ferr
+	}
+	w.done <- err
+}
+
+// write queues a record; it only blocks if the writer falls far behind.
+func (w *jsonlWriter) write(rec jsonlRecord) {
+	w.records <- rec
+}
+
+// close drains pending records, flushes and closes the file.
+func (w *jsonlWriter) close() error {
+	close(w.records)
+	err := <-w.done
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
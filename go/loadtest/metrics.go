@@ -0,0 +1,70 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// promMetrics holds the collectors exported on METRICS_ADDR. It is nil when
+// the metrics endpoint is disabled so the hot path only pays for a nil check.
+type promMetrics struct {
+	requests prometheus.Counter
+	success  prometheus.Counter
+	failures *prometheus.CounterVec
+	latency  prometheus.Histogram
+}
+
+func newPromMetrics(reg prometheus.Registerer) *promMetrics {
+	m := &promMetrics{
+		requests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loadtester_requests_total",
+			Help: "Total number of requests issued.",
+		}),
+		success: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loadtester_success_total",
+			Help: "Number of requests that completed successfully.",
+		}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loadtester_failures_total",
+			Help: "Number of failed requests by category.",
+		}, []string{"category"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "loadtester_request_duration_seconds",
+			Help:    "Response time of requests that completed a round trip.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}),
+	}
+	reg.MustRegister(m.requests, m.success, m.failures, m.latency)
+	return m
+}
+
+// startMetricsServer exposes /metrics on addr and returns the collectors to
+// record into along with a function that shuts the server down.
+func startMetricsServer(addr string) (*promMetrics, func()) {
+	reg := prometheus.NewRegistry()
+	metrics := newPromMetrics(reg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: metrics server on %s stopped: %v", addr, err)
+		}
+	}()
+
+	return metrics, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Warning: metrics server shutdown: %v", err)
+		}
+	}
+}
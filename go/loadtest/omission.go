@@ -0,0 +1,45 @@
+package loadtest
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// job is one request handed to the workers: its number and, in the open
+// model, the time the arrival was scheduled for.
+type job struct {
+	num int
+	due time.Time // zero in the closed model
+}
+
+// schedule is the fixed timeline requests are measured against with
+// CORRECT_COORDINATED_OMISSION in the closed model, where it also paces the
+// workers in place of the rate limiter. Request n is due (n-1) intervals
+// after the first measured request went out, however long earlier responses
+// took to arrive.
+type schedule struct {
+	interval time.Duration
+	origin   atomic.Int64 // UnixNano of the first measured request, 0 until then
+}
+
+func newSchedule(rps float64) *schedule {
+	return &schedule{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// due returns when request n should have been sent, starting the timeline at
+// now if n is the first request to ask.
+func (s *schedule) due(n int, now time.Time) time.Time {
+	s.origin.CompareAndSwap(0, now.UnixNano())
+	return time.Unix(0, s.origin.Load()).Add(time.Duration(n-1) * s.interval)
+}
+
+// correctedLatency measures res from due rather than from when it was
+// actually sent, so time spent queued behind a stalled server counts towards
+// its latency instead of silently thinning out the samples. Requests sent
+// ahead of schedule keep their measured latency.
+func correctedLatency(res result, due time.Time) time.Duration {
+	if lag := res.start.Sub(due); lag > 0 {
+		return res.latency + lag
+	}
+	return res.latency
+}
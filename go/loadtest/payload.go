@@ -0,0 +1,215 @@
+package loadtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/template"
+)
+
+// payload is one request body. Bodies containing template placeholders are
+// compiled once at startup and rendered per request; plain ones are sent as is.
+type payload struct {
+	body    []byte // ready to send, unless tmpl is set
+	tmpl    *template.Template
+	enc     *bodyEncoding // applied after every render, nil to send templates as rendered
+	rawSize int           // size of body before compression
+}
+
+// bodyEncoding turns a payload as written in its file into the bytes sent:
+// form or multipart encoding per CONTENT_TYPE, then gzip for COMPRESS_REQUEST.
+type bodyEncoding struct {
+	form      bool
+	multipart *multipartUpload // nil unless CONTENT_TYPE is multipart/form-data
+	compress  bool
+}
+
+// gzipWriters recycles compressors for templated payloads, which have to be
+// compressed again on every request.
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// apply encodes raw and also returns the encoded size before compression.
+func (e *bodyEncoding) apply(raw []byte) ([]byte, int) {
+	switch {
+	case e.form:
+		raw = encodeForm(raw)
+	case e.multipart != nil:
+		raw = e.multipart.encode(raw)
+	}
+	if !e.compress {
+		return raw, len(raw)
+	}
+	var buf bytes.Buffer
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+	zw.Reset(&buf)
+	zw.Write(raw)
+	zw.Close()
+	return buf.Bytes(), len(raw)
+}
+
+// newBodyEncoding returns the encoding every payload needs for cfg, or nil
+// if they are sent as written, along with the Content-Type header to send.
+func newBodyEncoding(cfg Config) (*bodyEncoding, string, error) {
+	enc := &bodyEncoding{compress: cfg.CompressRequest}
+	contentType := cfg.ContentType
+	mediaType, _, _ := mime.ParseMediaType(cfg.ContentType) // checked by Validate
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		enc.form = true
+	case "multipart/form-data":
+		up, err := newMultipartUpload(cfg.MultipartFile, cfg.MultipartField)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read multipart file: %w", err)
+		}
+		enc.multipart = up
+		contentType = up.contentType()
+	}
+	if !enc.form && enc.multipart == nil && !enc.compress {
+		return nil, contentType, nil
+	}
+	return enc, contentType, nil
+}
+
+func newPayload(name string, body []byte) (payload, error) {
+	tmpl, err := parseTemplate(name, string(body))
+	if err != nil {
+		return payload{}, fmt.Errorf("invalid payload template %s: %w", name, err)
+	}
+	return payload{body: body, tmpl: tmpl, rawSize: len(body)}, nil
+}
+
+// encodePayloads applies enc to every payload. Static bodies are encoded
+// once here; templated ones are encoded after each render.
+func encodePayloads(payloads []payload, enc *bodyEncoding) {
+	for i := range payloads {
+		p := &payloads[i]
+		p.enc = enc
+		if p.tmpl == nil {
+			p.body, p.rawSize = enc.apply(p.body)
+		}
+	}
+}
+
+// render returns the body for one request. buf is reused between calls, so
+// the result is only valid until the next render with the same buffer.
+func (p payload) render(vars templateVars, buf *bytes.Buffer) []byte {
+	if p.tmpl == nil {
+		return p.body
+	}
+	buf.Reset()
+	if err := p.tmpl.Execute(buf, vars); err != nil {
+		// parseTemplate already did a trial run, so this should not happen.
+		log.Printf("Warning: cannot render payload template %s: %v", p.tmpl.Name(), err)
+		return nil
+	}
+	if p.enc != nil {
+		body, _ := p.enc.apply(buf.Bytes())
+		return body
+	}
+	return buf.Bytes()
+}
+
+// payloadAlphabet is what generated payloads are made of: printable, so the
+// body survives logs and proxies, but random enough not to compress well.
+const payloadAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// generatePayload returns a body of size random characters for PAYLOAD_SIZE,
+// the same for a given seed.
+func generatePayload(size int, seed int64) payload {
+	rng := rand.New(rand.NewSource(seed))
+	body := make([]byte, size)
+	for i := range body {
+		body[i] = payloadAlphabet[rng.Intn(len(payloadAlphabet))]
+	}
+	return payload{body: body, rawSize: size}
+}
+
+// loadPayloadSequence reads a PAYLOAD_SEQUENCE file, a JSON array of
+// request bodies replayed in order. An element that is a JSON string is sent
+// as its content, so non-JSON bodies can be listed too; any other element is
+// sent as the JSON it is written as. Either may use template placeholders,
+// which have to be inside JSON strings for the file to parse.
+func loadPayloadSequence(path string) ([]payload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read payload sequence: %w", err)
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return nil, fmt.Errorf("payload sequence %s must be a JSON array of bodies: %w", path, err)
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("payload sequence %s is empty", path)
+	}
+	payloads := make([]payload, len(elems))
+	for i, e := range elems {
+		body := []byte(e)
+		var s string
+		if json.Unmarshal(e, &s) == nil {
+			body = []byte(s)
+		}
+		if payloads[i], err = newPayload(fmt.Sprintf("%s[%d]", path, i), body); err != nil {
+			return nil, err
+		}
+	}
+	return payloads, nil
+}
+
+// loadPayloads returns the request bodies to send. With dir (PAYLOAD_DIR) set
+// every *.json file in that directory is loaded and requests pick one at
+// random; otherwise the single file (PAYLOAD_FILE) is used, where "-" reads
+// it from stdin once at startup.
+func loadPayloads(dir, file string) ([]payload, error) {
+	if dir == "" {
+		var (
+			body []byte
+			err  error
+		)
+		if file == "-" {
+			body, err = io.ReadAll(os.Stdin)
+		} else {
+			body, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read payload: %w", err)
+		}
+		p, err := newPayload(file, body)
+		if err != nil {
+			return nil, err
+		}
+		return []payload{p}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list payload directory %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.json files found in payload directory %s", dir)
+	}
+	sort.Strings(files) // stable order so SEED gives reproducible selection
+
+	payloads := make([]payload, 0, len(files))
+	for _, f := range files {
+		body, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read payload: %w", err)
+		}
+		p, err := newPayload(f, body)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, p)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,37 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// startPprofServer serves the runtime profiles of the tester itself on addr,
+// which helps tell a saturated load generator from a saturated target. The
+// returned func shuts the server down.
+func startPprofServer(addr string) func() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: pprof server on %s stopped: %v", addr, err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Warning: pprof server shutdown: %v", err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package loadtest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgressBar redraws a single progress line on stderr until the
+// returned stop function is called. Completion is measured against the total
+// request count, or against the elapsed time in duration mode.
+func startProgressBar(cfg Config, st *stats, start time.Time) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	draw := func(now time.Time) {
+		success := atomic.LoadUint64(&st.success)
+		failure := atomic.LoadUint64(&st.failure)
+		total := success + failure
+
+		var frac float64
+		if cfg.Duration > 0 {
+			frac = float64(now.Sub(start)) / float64(cfg.Duration)
+		} else if planned := cfg.TotalRequests; planned > 0 {
+			if cfg.MaxRequests > 0 {
+				planned = min(planned, cfg.MaxRequests)
+			}
+			frac = float64(total) / float64(planned)
+		}
+		frac = min(max(frac, 0), 1)
+
+		var rps float64
+		if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+			rps = float64(total) / elapsed
+		}
+
+		filled := int(frac * progressBarWidth)
+		bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+		fmt.Fprintf(os.Stderr, "\r%s %5.1f%% | %d requests | %.2f RPS | ✅ %d ❌ %d ", bar, frac*100, total, rps, success, failure)
+	}
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				draw(time.Now())
+				fmt.Fprintln(os.Stderr)
+				return
+			case now := <-ticker.C:
+				draw(now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
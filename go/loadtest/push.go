@@ -0,0 +1,215 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pushedGauge is one value of a final report as pushed to STATSD_ADDR or
+// OTLP_ENDPOINT. A gauge with an attribute is one of a family, such as the
+// failures of each category: statsd appends the attribute value to the name,
+// OTLP sends it as a data point attribute.
+type pushedGauge struct {
+	name  string // dotted, after the prefix
+	unit  string // UCUM unit, for OTLP
+	value float64
+	attr  [2]string // key and value, both empty if none
+}
+
+// reportGauges lists the counters and latency summary of r.
+func reportGauges(r Report) []pushedGauge {
+	gauges := []pushedGauge{
+		{name: "duration", unit: "ms", value: r.DurationMs},
+		{name: "requests", unit: "{request}", value: float64(r.Total)},
+		{name: "success", unit: "{request}", value: float64(r.Success)},
+		{name: "failure", unit: "{request}", value: float64(r.Failure)},
+		{name: "failure_rate", unit: "1", value: r.FailureRate},
+		{name: "retries", unit: "{request}", value: float64(r.Retries)},
+		{name: "rps", unit: "{request}/s", value: r.RPS},
+		{name: "bytes", unit: "By", value: float64(r.Bytes)},
+		{name: "latency.min", unit: "ms", value: r.Latency.Min},
+		{name: "latency.avg", unit: "ms", value: r.Latency.Avg},
+		{name: "latency.max", unit: "ms", value: r.Latency.Max},
+		{name: "latency.stddev", unit: "ms", value: r.Latency.StdDev},
+		{name: "peak_inflight", unit: "{request}", value: float64(r.PeakInflight)},
+	}
+	if r.Interrupted || r.Aborted {
+		gauges = append(gauges, pushedGauge{name: "interrupted", unit: "1", value: 1})
+	}
+	for _, label := range sortedKeys(r.Latency.Percentiles) {
+		gauges = append(gauges, pushedGauge{name: "latency", unit: "ms", value: r.Latency.Percentiles[label], attr: [2]string{"percentile", label}})
+	}
+	for _, key := range sortedKeys(r.Failures) {
+		gauges = append(gauges, pushedGauge{name: "failures", unit: "{request}", value: float64(r.Failures[key]), attr: [2]string{"category", key}})
+	}
+	codes := make([]int, 0, len(r.StatusCodes))
+	for code := range r.StatusCodes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		gauges = append(gauges, pushedGauge{name: "responses", unit: "{response}", value: float64(r.StatusCodes[code]), attr: [2]string{"code", strconv.Itoa(code)}})
+	}
+	return gauges
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// PushMetrics sends the counters and latency summary of r as gauges to the
+// statsd server at STATSD_ADDR and the OpenTelemetry collector at
+// OTLP_ENDPOINT, whichever are set, for dashboards that are not fed by
+// scraping METRICS_ADDR. Both are tried even if one fails.
+func PushMetrics(cfg Config, r Report) error {
+	gauges := reportGauges(r)
+	var errs []error
+	if cfg.StatsdAddr != "" {
+		if err := pushStatsd(cfg.StatsdAddr, cfg.MetricsPrefix, gauges); err != nil {
+			errs = append(errs, fmt.Errorf("statsd push to %s: %w", cfg.StatsdAddr, err))
+		}
+	}
+	if cfg.OTLPEndpoint != "" {
+		if err := pushOTLP(cfg.OTLPEndpoint, cfg.MetricsPrefix, gauges, time.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("OTLP push to %s: %w", cfg.OTLPEndpoint, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// statsdPacketSize keeps each datagram within the usual Ethernet MTU, as
+// statsd servers read one packet at a time.
+const statsdPacketSize = 1432
+
+// pushStatsd sends gauges over UDP as prefix.name[.attr]:value|g lines,
+// several to a packet.
+func pushStatsd(addr, prefix string, gauges []pushedGauge) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, g := range gauges {
+		name := g.name
+		if g.attr[1] != "" {
+			name += "." + g.attr[1]
+		}
+		line := fmt.Sprintf("%s.%s:%s|g", prefix, name, strconv.FormatFloat(g.value, 'f', -1, 64))
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// OTLP/HTTP JSON encoding of gauges, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding. 64-bit
+// integers are strings in this encoding.
+type (
+	otlpAttribute struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	otlpDataPoint struct {
+		TimeUnixNano string          `json:"timeUnixNano"`
+		AsDouble     float64         `json:"asDouble"`
+		Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	}
+	otlpMetric struct {
+		Name  string `json:"name"`
+		Unit  string `json:"unit"`
+		Gauge struct {
+			DataPoints []otlpDataPoint `json:"dataPoints"`
+		} `json:"gauge"`
+	}
+)
+
+func otlpAttr(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+// pushOTLP posts gauges, stamped with now, to the collector's OTLP/HTTP
+// endpoint, such as http://collector:4318; /v1/metrics is added unless the
+// URL already has a path. A family of gauges becomes one metric with a data
+// point per attribute value.
+func pushOTLP(endpoint, prefix string, gauges []pushedGauge, now time.Time) error {
+	var metrics []*otlpMetric
+	byName := make(map[string]*otlpMetric)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	for _, g := range gauges {
+		m := byName[g.name]
+		if m == nil {
+			m = &otlpMetric{Name: prefix + "." + g.name, Unit: g.unit}
+			byName[g.name] = m
+			metrics = append(metrics, m)
+		}
+		dp := otlpDataPoint{TimeUnixNano: ts, AsDouble: g.value}
+		if g.attr[0] != "" {
+			dp.Attributes = []otlpAttribute{otlpAttr(g.attr[0], g.attr[1])}
+		}
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpAttribute{otlpAttr("service.name", "load-tester")}},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]string{"name": "load-tester"},
+				"metrics": metrics,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(endpoint) // checked by Validate
+	if err != nil {
+		return err
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/metrics"
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
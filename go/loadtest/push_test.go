@@ -0,0 +1,104 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testGauges() []pushedGauge {
+	return reportGauges(Report{
+		DurationMs:  1500,
+		Total:       10,
+		Success:     9,
+		Failure:     1,
+		Failures:    map[string]uint64{"http_5xx": 1},
+		StatusCodes: map[int]uint64{200: 9, 503: 1},
+		Latency:     LatencyReport{Min: 1, Avg: 2.5, Max: 7, Percentiles: map[string]float64{"p99": 6.5}},
+	})
+}
+
+func TestPushStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := pushStatsd(conn.LocalAddr().String(), "lt", testGauges()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, statsdPacketSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	for _, want := range []string{"lt.duration:1500|g", "lt.requests:10|g", "lt.failures.http_5xx:1|g", "lt.responses.503:1|g", "lt.latency.p99:6.5|g", "lt.latency.avg:2.5|g"} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("packet %q has no line %q", lines, want)
+		}
+	}
+}
+
+func TestPushOTLP(t *testing.T) {
+	var (
+		path string
+		body struct {
+			ResourceMetrics []struct {
+				ScopeMetrics []struct {
+					Metrics []otlpMetric `json:"metrics"`
+				} `json:"scopeMetrics"`
+			} `json:"resourceMetrics"`
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	if err := pushOTLP(srv.URL, "lt", testGauges(), now); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/metrics" {
+		t.Errorf("posted to %q, want /v1/metrics", path)
+	}
+	metrics := make(map[string]otlpMetric)
+	for _, rm := range body.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m
+			}
+		}
+	}
+	if m := metrics["lt.requests"]; len(m.Gauge.DataPoints) != 1 || m.Gauge.DataPoints[0].AsDouble != 10 || m.Gauge.DataPoints[0].TimeUnixNano != "1700000000000000000" {
+		t.Errorf("lt.requests is %+v, want one data point of 10 at the push time", m)
+	}
+	codes := make(map[string]float64)
+	for _, dp := range metrics["lt.responses"].Gauge.DataPoints {
+		if len(dp.Attributes) == 1 && dp.Attributes[0].Key == "code" {
+			codes[dp.Attributes[0].Value.StringValue] = dp.AsDouble
+		}
+	}
+	if want := map[string]float64{"200": 9, "503": 1}; !maps.Equal(codes, want) {
+		t.Errorf("lt.responses by code %v, want %v", codes, want)
+	}
+
+	srv.Close()
+	if err := pushOTLP(srv.URL, "lt", testGauges(), now); err == nil {
+		t.Error("a push to a stopped collector succeeded")
+	}
+}
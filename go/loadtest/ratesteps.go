@@ -0,0 +1,173 @@
+package loadtest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateStep is one step of a RATE_SCHEDULE: send RPS requests per second for
+// Duration.
+type RateStep struct {
+	Duration time.Duration
+	RPS      float64
+}
+
+// RateStepReport compares the rate a RATE_SCHEDULE step asked for with the
+// rate of the requests that completed during it.
+type RateStepReport struct {
+	DurationMs  float64 `json:"duration_ms"` // how much of the step the run lasted
+	TargetRPS   float64 `json:"target_rps"`
+	AchievedRPS float64 `json:"achieved_rps"`
+	Requests    uint64  `json:"requests"`
+}
+
+// LoadRateSchedule reads a RATE_SCHEDULE file: one duration:rps step per
+// line, such as 1m:100, run in order. Blank lines and lines starting with #
+// are skipped.
+func LoadRateSchedule(path string) ([]RateStep, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rate schedule: %w", err)
+	}
+	defer f.Close()
+
+	var steps []RateStep
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d, r, ok := strings.Cut(line, ":")
+		dur, derr := time.ParseDuration(strings.TrimSpace(d))
+		rps, rerr := strconv.ParseFloat(strings.TrimSpace(r), 64)
+		if !ok || derr != nil || rerr != nil {
+			return nil, fmt.Errorf("%s line %d: want duration:rps such as 30s:100, got %q", path, n, line)
+		}
+		steps = append(steps, RateStep{Duration: dur, RPS: rps})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read rate schedule: %w", err)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("rate schedule %s has no steps", path)
+	}
+	return steps, nil
+}
+
+// rateSchedule follows a RATE_SCHEDULE during a run. In the closed model it
+// retunes the shared limiter at every step boundary; the open model's
+// producer looks up the current rate for every arrival instead. Completed
+// requests are counted per step, so the report can show the rate achieved.
+// Once the last step ends its rate holds until the run does.
+type rateSchedule struct {
+	steps  []RateStep
+	ends   []time.Duration // end of each step, measured from start
+	counts []uint64
+	start  time.Time
+}
+
+func newRateSchedule(steps []RateStep) *rateSchedule {
+	s := &rateSchedule{steps: steps, ends: make([]time.Duration, len(steps)), counts: make([]uint64, len(steps))}
+	var end time.Duration
+	for i, st := range steps {
+		end += st.Duration
+		s.ends[i] = end
+	}
+	return s
+}
+
+// total is how long the schedule lasts.
+func (s *rateSchedule) total() time.Duration {
+	return s.ends[len(s.ends)-1]
+}
+
+// stepAt returns the step that is current elapsed into the run.
+func (s *rateSchedule) stepAt(elapsed time.Duration) int {
+	for i, end := range s.ends {
+		if elapsed < end {
+			return i
+		}
+	}
+	return len(s.steps) - 1
+}
+
+// rpsAt returns the target rate elapsed into the run.
+func (s *rateSchedule) rpsAt(elapsed time.Duration) float64 {
+	return s.steps[s.stepAt(elapsed)].RPS
+}
+
+// begin starts following the schedule at start. With a limiter, a goroutine
+// moves it on to each step's rate until ctx is done.
+func (s *rateSchedule) begin(ctx context.Context, start time.Time, limiter *rate.Limiter, logSteps bool) {
+	s.start = start
+	if limiter == nil && !logSteps {
+		return
+	}
+	go func() {
+		for i := 1; i < len(s.steps); i++ {
+			select {
+			case <-time.After(time.Until(start.Add(s.ends[i-1]))):
+			case <-ctx.Done():
+				return
+			}
+			if limiter != nil {
+				limiter.SetLimit(rate.Limit(s.steps[i].RPS))
+			}
+			if logSteps {
+				log.Printf("Rate schedule: step %d/%d, %g RPS for %s", i+1, len(s.steps), s.steps[i].RPS, s.steps[i].Duration)
+			}
+		}
+	}()
+}
+
+// record counts a request that completed at now.
+func (s *rateSchedule) record(now time.Time) {
+	atomic.AddUint64(&s.counts[s.stepAt(now.Sub(s.start))], 1)
+}
+
+// report compares the target and achieved rate of every step for a run that
+// lasted elapsed. Steps the run did not reach are reported with no requests.
+func (s *rateSchedule) report(elapsed time.Duration) []RateStepReport {
+	out := make([]RateStepReport, len(s.steps))
+	var from time.Duration
+	for i, st := range s.steps {
+		ran := min(elapsed, s.ends[i]) - from
+		if i == len(s.steps)-1 {
+			ran = elapsed - from // the last rate holds past the schedule's end
+		}
+		ran = max(ran, 0)
+		out[i] = RateStepReport{
+			DurationMs: float64(ran.Milliseconds()),
+			TargetRPS:  st.RPS,
+			Requests:   atomic.LoadUint64(&s.counts[i]),
+		}
+		if ran > 0 {
+			out[i].AchievedRPS = float64(out[i].Requests) / ran.Seconds()
+		}
+		from = s.ends[i]
+	}
+	return out
+}
+
+// meanRPS is the time-weighted target rate over steps.
+func meanRPS(steps []RateStepReport) float64 {
+	var sum, ms float64
+	for _, s := range steps {
+		sum += s.TargetRPS * s.DurationMs
+		ms += s.DurationMs
+	}
+	if ms == 0 {
+		return 0
+	}
+	return sum / ms
+}
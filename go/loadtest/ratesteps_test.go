@@ -0,0 +1,58 @@
+package loadtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRateSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.txt")
+	if err := os.WriteFile(path, []byte("# warm up\n30s:10\n\n 1m : 50.5 \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	steps, err := LoadRateSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []RateStep{{30 * time.Second, 10}, {time.Minute, 50.5}}; !slices.Equal(steps, want) {
+		t.Errorf("LoadRateSchedule() = %v, want %v", steps, want)
+	}
+
+	if err := os.WriteFile(path, []byte("30s:10\n1m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRateSchedule(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("LoadRateSchedule() = %v, want an error for line 2", err)
+	}
+}
+
+func TestRateScheduleReport(t *testing.T) {
+	s := newRateSchedule([]RateStep{{time.Second, 10}, {2 * time.Second, 20}, {time.Second, 5}})
+	start := time.Now()
+	s.begin(context.Background(), start, nil, false)
+	for _, at := range []time.Duration{0, 500 * time.Millisecond, 900 * time.Millisecond, 1500 * time.Millisecond, 2999 * time.Millisecond} {
+		s.record(start.Add(at))
+	}
+
+	// The run ends half-way through the second step, so the last is never reached.
+	got := s.report(2 * time.Second)
+	want := []RateStepReport{
+		{DurationMs: 1000, TargetRPS: 10, AchievedRPS: 3, Requests: 3},
+		{DurationMs: 1000, TargetRPS: 20, AchievedRPS: 2, Requests: 2},
+		{DurationMs: 0, TargetRPS: 5},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("report(2s) = %+v, want %+v", got, want)
+	}
+
+	// The last step's rate holds past the end of the schedule.
+	s.record(start.Add(5 * time.Second))
+	if last := s.report(6 * time.Second)[2]; last.DurationMs != 3000 || last.Requests != 1 {
+		t.Errorf("last step %+v, want it to cover the 3s run past the schedule with 1 request", last)
+	}
+}
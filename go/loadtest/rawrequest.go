@@ -0,0 +1,95 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// rawRequestDropped are the headers of a RAW_REQUEST_FILE that describe the
+// original connection or body framing rather than the request, and are
+// recomputed for every send instead.
+var rawRequestDropped = []string{"Content-Length", "Transfer-Encoding", "Connection", "Keep-Alive"}
+
+// loadRawRequest reads a RAW_REQUEST_FILE, a complete HTTP/1.x request as
+// saved from a proxy or browser, into a target with its method, headers and
+// body. Like a payload file, the body may contain template placeholders.
+// Unless it is chunked, the body is everything after the headers, minus one
+// trailing newline an editor may have added: a Content-Length would no
+// longer match once the body has been edited, so it is ignored.
+//
+// Requests are sent to the scheme and host of base if it is set, so one
+// captured request can be replayed against another environment. Otherwise
+// an absolute request target is used as it is, and a path is sent over
+// plain HTTP to the request's Host.
+func loadRawRequest(path, base string) (*target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(bytes.NewReader(data))
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse raw request %s: %w", path, err)
+	}
+	var body []byte
+	if len(req.TransferEncoding) > 0 {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("cannot read body of raw request %s: %w", path, err)
+		}
+	} else {
+		body, _ = io.ReadAll(br) // req.Body has not consumed any of it
+		body = bytes.TrimSuffix(bytes.TrimSuffix(body, []byte("\n")), []byte("\r"))
+	}
+	if !validMethods[req.Method] {
+		return nil, fmt.Errorf("raw request %s: HTTP method %q is not supported", path, req.Method)
+	}
+
+	// The request target is kept as written rather than re-encoded through
+	// url.URL, which would escape the braces of URL placeholders.
+	scheme, host, rest := "http", req.Host, req.RequestURI
+	if req.URL.IsAbs() {
+		scheme, host = req.URL.Scheme, req.URL.Host
+		rest = strings.TrimPrefix(rest, scheme+"://"+host)
+	}
+	switch {
+	case base != "":
+		b, err := url.Parse(base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target URL %q: %w", base, err)
+		}
+		scheme, host = b.Scheme, b.Host
+	case host == "":
+		return nil, fmt.Errorf("raw request %s has no Host header; set TARGET_URL to say where to send it", path)
+	}
+
+	t, err := newTarget(scheme + "://" + host + rest)
+	if err != nil {
+		return nil, err
+	}
+	t.method = req.Method
+	for _, k := range rawRequestDropped {
+		req.Header.Del(k)
+	}
+	if len(req.Header) > 0 {
+		t.headers = make(map[string]string, len(req.Header))
+		for k, v := range req.Header {
+			t.headers[k] = strings.Join(v, ", ")
+		}
+	}
+	if methodHasBody(req.Method) {
+		// An empty body is sent as such rather than replaced by the run's
+		// payload.
+		p, err := newPayload(path, body)
+		if err != nil {
+			return nil, err
+		}
+		t.payloads = []payload{p}
+	}
+	return t, nil
+}
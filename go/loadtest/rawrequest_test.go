@@ -0,0 +1,54 @@
+package loadtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRawRequest(t *testing.T) {
+	tests := []struct {
+		name, raw, base string
+		wantURL         string
+		wantBody        string
+		wantErr         bool
+	}{
+		{"host header", "GET /a?b=1 HTTP/1.1\r\nHost: api.example.com\r\n\r\n", "", "http://api.example.com/a?b=1", "", false},
+		{"absolute target", "POST https://api.example.com/a HTTP/1.1\r\nHost: other\r\n\r\n{}\n", "", "https://api.example.com/a", "{}", false},
+		{"base overrides the host", "POST /a HTTP/1.1\r\nHost: api.example.com\r\n\r\n{}", "https://staging:8443/ignored", "https://staging:8443/a", "{}", false},
+		{"chunked body", "POST /a HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n", "", "http://h/a", "abcde", false},
+		{"no host", "GET /a HTTP/1.0\r\n\r\n", "", "", "", true},
+		{"not a request", "hello\r\n\r\n", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "request.http")
+			if err := os.WriteFile(path, []byte(tt.raw), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tgt, err := loadRawRequest(path, tt.base)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadRawRequest() = %+v, want an error", tgt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tgt.url != tt.wantURL {
+				t.Errorf("URL %q, want %q", tgt.url, tt.wantURL)
+			}
+			var body string
+			if tgt.payloads != nil {
+				body = string(tgt.payloads[0].body)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body %q, want %q", body, tt.wantBody)
+			}
+			if _, ok := tgt.headers["Host"]; ok || tgt.headers["Transfer-Encoding"] != "" {
+				t.Errorf("headers %v, want the connection and framing headers dropped", tgt.headers)
+			}
+		})
+	}
+}
@@ -0,0 +1,657 @@
+package loadtest
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Report is the summary of a finished (or interrupted) test run.
+type Report struct {
+	DurationMs   float64            `json:"duration_ms"`
+	Interrupted  bool               `json:"interrupted"`
+	CapReached   bool               `json:"max_requests_reached"`
+	Aborted      bool               `json:"aborted"` // stopped by ABORT_ERROR_RATE
+	Total        uint64             `json:"total"`
+	Success      uint64             `json:"success"`
+	Failure      uint64             `json:"failure"`
+	FailureRate  float64            `json:"failure_rate"`
+	Timed        uint64             `json:"timed"` // requests that completed a round trip, the only ones Latency covers
+	Failures     map[string]uint64  `json:"failures,omitempty"`
+	Retries      uint64             `json:"retries"`
+	Warmup       uint64             `json:"warmup_requests"`
+	Seed         int64              `json:"seed"`
+	Model        string             `json:"arrival_model"`
+	COCorrected  bool               `json:"coordinated_omission_corrected,omitempty"`
+	HeadOnly     bool               `json:"head_only,omitempty"` // every request was HEAD, so no body bytes are expected
+	Late         uint64             `json:"late_arrivals,omitempty"`
+	PeakInflight int64              `json:"peak_inflight"`
+	MaxInflight  int                `json:"max_inflight,omitempty"`
+	Protocols    map[string]uint64  `json:"protocols,omitempty"`
+	ConnsNew     uint64             `json:"connections_new"`
+	ConnsReused  uint64             `json:"connections_reused"`
+	Redirected   uint64             `json:"redirected,omitempty"`    // requests that were redirected, see FOLLOW_REDIRECTS
+	RedirectHops uint64             `json:"redirect_hops,omitempty"` // redirects followed, 0 when not following
+	ReuseRatio   float64            `json:"connection_reuse_ratio"`
+	StatusCodes  map[int]uint64     `json:"status_codes,omitempty"` // for gRPC, the HTTP equivalents of GRPCCodes
+	GRPCCodes    map[string]uint64  `json:"grpc_codes,omitempty"`
+	Bytes        uint64             `json:"bytes"`
+	WireBytes    uint64             `json:"wire_bytes"`
+	MBPerSec     float64            `json:"mb_per_sec"`
+	AvgRespSize  float64            `json:"avg_response_bytes"`
+	RPS          float64            `json:"rps"`
+	TargetRPS    float64            `json:"target_rps,omitempty"`
+	RampUpMs     float64            `json:"ramp_up_ms,omitempty"`
+	Latency      LatencyReport      `json:"latency_ms"`
+	Timing       map[string]float64 `json:"timing_ms,omitempty"`
+	Histogram    []HistogramBucket  `json:"latency_histogram,omitempty"`
+	Targets      []TargetReport     `json:"targets,omitempty"`
+	Tokens       []TokenReport      `json:"tokens,omitempty"`
+	Threads      []ThreadReport     `json:"threads,omitempty"`
+	Resources    *ResourceStats     `json:"resources,omitempty"`
+	RateSteps    []RateStepReport   `json:"rate_steps,omitempty"`
+	Sequence     *SequenceReport    `json:"payload_sequence,omitempty"`
+	RateLimited  uint64             `json:"rate_limited"` // 429 Too Many Requests responses
+	RetryAfter   *RetryAfterReport  `json:"retry_after,omitempty"`
+	Abandoned    int64              `json:"abandoned,omitempty"` // requests still in flight at DRAIN_TIMEOUT, left out of the counts
+	Handshakes   *HandshakeReport   `json:"websocket_handshakes,omitempty"`
+	FirstFailure *FirstFailReport   `json:"first_failure,omitempty"`
+	Oversized    uint64             `json:"oversized,omitempty"` // responses longer than MAX_RESPONSE_BYTES, read only up to it
+
+	// The raw latency distribution behind Latency, kept so that reports
+	// from several agents can be merged exactly.
+	sketch   latencySketch
+	variance welford
+}
+
+// RetryAfterReport is how long workers paused for Retry-After headers,
+// present when HONOR_RETRY_AFTER is set.
+type RetryAfterReport struct {
+	Waits    uint64  `json:"waits"`
+	WaitedMs float64 `json:"waited_ms"`
+}
+
+// FirstFailReport is how far a run got before requests started to fail,
+// present when any did. Warm-up requests are left out. Requests are
+// numbered as they are handed out, so when the lowest-numbered one failed
+// some numbered before it may still have been in flight, retried or never
+// sent; only each worker's own count is exact, as it sends in order.
+type FirstFailReport struct {
+	Request   uint64 `json:"request"`        // lowest number of a failed request
+	Workers   int    `json:"workers_failed"` // workers that had a failure
+	WorkerMin uint64 `json:"worker_min"`     // fewest requests a worker sent up to and including its first failure
+	WorkerMax uint64 `json:"worker_max"`     // most requests a worker sent up to and including its first failure
+}
+
+// HandshakeReport is how the WebSocket connections of a PROTOCOL=websocket
+// run were opened; the Latency of the Report then covers the message round
+// trips only.
+type HandshakeReport struct {
+	Opened  uint64        `json:"opened"`
+	Failed  uint64        `json:"failed"`     // each also counted as a failed message
+	Latency LatencyReport `json:"latency_ms"` // without stddev
+
+	hist *histogram // kept for merging, like Report's
+}
+
+// SequenceReport is how far a PAYLOAD_SEQUENCE was replayed.
+type SequenceReport struct {
+	Length uint64 `json:"length"` // bodies in the sequence
+	Sent   uint64 `json:"sent"`   // bodies handed out, including warm-up requests
+	Cycles uint64 `json:"cycles"` // times the whole sequence was sent
+}
+
+// TargetReport is the per-URL breakdown, present when more than one target is configured.
+type TargetReport struct {
+	Name    string        `json:"name,omitempty"` // scenario name, see SCENARIO_FILE
+	URL     string        `json:"url"`
+	Total   uint64        `json:"total"`
+	Success uint64        `json:"success"`
+	Failure uint64        `json:"failure"`
+	Timed   uint64        `json:"timed"`
+	Latency LatencyReport `json:"latency_ms"`
+}
+
+// ThreadReport is one worker's share of the run, present when
+// PER_THREAD_STATS is set. Workers are numbered from 1, as in the request log.
+type ThreadReport struct {
+	Agent   string        `json:"agent,omitempty"` // set in a distributed run, whose agents number their workers alike
+	Thread  int           `json:"thread"`
+	Total   uint64        `json:"total"`
+	Success uint64        `json:"success"`
+	Failure uint64        `json:"failure"`
+	Latency LatencyReport `json:"latency_ms"` // without percentiles
+
+	FirstFailure uint64 `json:"first_failure,omitempty"` // requests up to and including the worker's first failure
+}
+
+// TokenReport is the per-token breakdown, present when AUTH_TOKENS_FILE is set.
+// Tokens are identified by a masked label rather than their value.
+type TokenReport struct {
+	Label     string `json:"label"`
+	Total     uint64 `json:"total"`
+	Success   uint64 `json:"success"`
+	Failure   uint64 `json:"failure"`
+	Throttled uint64 `json:"throttled"` // failures answered with 429 Too Many Requests
+}
+
+// HistogramBucket is one bar of the latency histogram: the responses that
+// took at least FromMs and less than ToMs. The last bucket is open-ended and
+// has no ToMs.
+type HistogramBucket struct {
+	FromMs float64 `json:"from_ms"`
+	ToMs   float64 `json:"to_ms,omitempty"`
+	Count  uint64  `json:"count"`
+}
+
+// LatencyReport holds response time statistics in milliseconds.
+type LatencyReport struct {
+	Min         float64            `json:"min"`
+	Avg         float64            `json:"avg"`
+	Max         float64            `json:"max"`
+	StdDev      float64            `json:"stddev"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// percentileLabel formats a percentile such as 99.9 as "p99.9".
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// buildReport snapshots the counters of a run into a Report.
+func buildReport(cfg Config, rs *runState, duration time.Duration, interrupted bool) Report {
+	st := rs.stats
+	r := Report{
+		DurationMs:   float64(duration.Milliseconds()),
+		Interrupted:  interrupted,
+		CapReached:   rs.capped.Load(),
+		Aborted:      rs.breaker != nil && rs.breaker.tripped.Load(),
+		Success:      atomic.LoadUint64(&st.success),
+		Failure:      atomic.LoadUint64(&st.failure),
+		Retries:      atomic.LoadUint64(&st.retries),
+		Warmup:       atomic.LoadUint64(&st.warmup),
+		Seed:         cfg.Seed,
+		Model:        "closed",
+		Late:         atomic.LoadUint64(&st.late),
+		PeakInflight: atomic.LoadInt64(&st.peakInflight),
+		MaxInflight:  cfg.MaxInflight,
+		Failures:     make(map[string]uint64),
+		TargetRPS:    cfg.TargetRPS,
+		RampUpMs:     float64(cfg.RampUp.Milliseconds()),
+	}
+	if cfg.openModel() {
+		r.Model = "open"
+	}
+	r.COCorrected = cfg.CorrectCoordinatedOmission
+	r.HeadOnly = headOnly(cfg, rs.targets)
+	r.Total = r.Success + r.Failure
+	if r.Total > 0 {
+		r.FailureRate = float64(r.Failure) / float64(r.Total)
+	}
+	r.Bytes = atomic.LoadUint64(&st.bytesRead)
+	r.Oversized = atomic.LoadUint64(&st.oversized)
+	r.WireBytes = atomic.LoadUint64(&st.wireBytes)
+	if duration.Seconds() > 0 {
+		r.RPS = float64(r.Total) / duration.Seconds()
+		r.MBPerSec = float64(r.Bytes) / 1_000_000.0 / duration.Seconds()
+	}
+	if responses := atomic.LoadUint64(&st.responses); responses > 0 {
+		r.AvgRespSize = float64(r.Bytes) / float64(responses)
+	}
+
+	for c := range numFailureCategories {
+		if n := atomic.LoadUint64(&st.failures[c]); n > 0 {
+			r.Failures[failureKeys[c]] = n
+		}
+	}
+	r.StatusCodes = st.statusCodes()
+	st.codesMu.Lock()
+	r.GRPCCodes = maps.Clone(st.rpcCodes)
+	st.codesMu.Unlock()
+	r.RateLimited = r.StatusCodes[http.StatusTooManyRequests]
+	if cfg.HonorRetryAfter {
+		r.RetryAfter = &RetryAfterReport{
+			Waits:    atomic.LoadUint64(&st.waits),
+			WaitedMs: float64(atomic.LoadUint64(&st.waitedNs)) / 1_000_000.0,
+		}
+	}
+	r.ConnsNew = atomic.LoadUint64(&st.connsNew)
+	r.ConnsReused = atomic.LoadUint64(&st.connsReused)
+	r.ReuseRatio = reuseRatio(r.ConnsNew, r.ConnsReused)
+	r.Redirected = atomic.LoadUint64(&st.redirected)
+	r.RedirectHops = atomic.LoadUint64(&st.redirectHops)
+	r.Protocols = make(map[string]uint64)
+	for i, name := range protoNames {
+		if n := atomic.LoadUint64(&st.protos[i]); n > 0 {
+			r.Protocols[name] = n
+		}
+	}
+
+	// Failures that never got a response have no latency, so they must not
+	// dilute the average.
+	if r.Timed = atomic.LoadUint64(&st.timed); r.Timed > 0 {
+		r.Latency.Avg = float64(atomic.LoadUint64(&st.totalNs)) / float64(r.Timed) / 1_000_000.0
+	}
+	if minFinal := atomic.LoadUint64(&st.minNs); minFinal != ^uint64(0) { // check if it was updated from initial max value
+		r.Latency.Min = float64(minFinal) / 1_000_000.0
+	}
+	r.Latency.Max = float64(atomic.LoadUint64(&st.maxNs)) / 1_000_000.0
+	st.varMu.Lock()
+	r.variance = st.variance
+	st.varMu.Unlock()
+	r.Latency.StdDev = r.variance.stddev() / 1_000_000.0
+
+	if cfg.TraceTiming {
+		r.Timing = make(map[string]float64, numPhases)
+		for i, name := range phaseNames {
+			if n := atomic.LoadUint64(&st.phaseCount[i]); n > 0 {
+				r.Timing[name] = float64(atomic.LoadUint64(&st.phaseNs[i])) / float64(n) / 1_000_000.0
+			}
+		}
+	}
+
+	r.sketch = st.sketch
+	r.Latency.Percentiles = latencyPercentiles(cfg.reportedPercentiles(), r.sketch)
+	r.Histogram = histogramBuckets(cfg.LatencyBuckets, r.sketch)
+
+	if len(rs.targets.list) > 1 {
+		for _, t := range rs.targets.list {
+			tr := TargetReport{
+				Name:    t.name,
+				URL:     t.url,
+				Success: atomic.LoadUint64(&t.success),
+				Failure: atomic.LoadUint64(&t.failure),
+				Timed:   atomic.LoadUint64(&t.timed),
+			}
+			tr.Total = tr.Success + tr.Failure
+			if tr.Timed > 0 {
+				tr.Latency.Avg = float64(atomic.LoadUint64(&t.totalNs)) / float64(tr.Timed) / 1_000_000.0
+				tr.Latency.Min = float64(atomic.LoadUint64(&t.minNs)) / 1_000_000.0
+				tr.Latency.Max = float64(atomic.LoadUint64(&t.maxNs)) / 1_000_000.0
+			}
+			r.Targets = append(r.Targets, tr)
+		}
+	}
+	if rs.tokens != nil {
+		for i, t := range rs.tokens.list {
+			tr := TokenReport{
+				Label:     tokenLabel(i),
+				Success:   atomic.LoadUint64(&t.success),
+				Failure:   atomic.LoadUint64(&t.failure),
+				Throttled: atomic.LoadUint64(&t.throttled),
+			}
+			tr.Total = tr.Success + tr.Failure
+			r.Tokens = append(r.Tokens, tr)
+		}
+	}
+	if rs.drain != nil {
+		r.Abandoned = rs.drain.abandoned
+	}
+	if cfg.websocket() {
+		r.Handshakes = st.handshakes.report(cfg.reportedPercentiles())
+	}
+	if n := atomic.LoadUint64(&st.firstFailure); n > 0 {
+		st.varMu.Lock()
+		r.FirstFailure = &FirstFailReport{Request: n, Workers: st.workersFailed, WorkerMin: st.workerFirstMin, WorkerMax: st.workerFirstMax}
+		st.varMu.Unlock()
+	}
+	if cfg.PerThreadStats {
+		st.varMu.Lock()
+		r.Threads = slices.Clone(st.threads)
+		st.varMu.Unlock()
+		slices.SortFunc(r.Threads, func(a, b ThreadReport) int { return a.Thread - b.Thread })
+	}
+	if cfg.PayloadSequence != "" && rs.payloads != nil {
+		r.Sequence = &SequenceReport{Length: uint64(len(rs.payloads)), Sent: atomic.LoadUint64(&rs.seqNext)}
+		r.Sequence.Cycles = r.Sequence.Sent / r.Sequence.Length
+	}
+	if rs.rates != nil {
+		// The target is averaged over the time each step actually ran.
+		r.RateSteps = rs.rates.report(duration)
+		r.TargetRPS = meanRPS(r.RateSteps)
+	}
+	return r
+}
+
+// reuseRatio is the share of requests that were sent on a reused connection.
+func reuseRatio(fresh, reused uint64) float64 {
+	if fresh+reused == 0 {
+		return 0
+	}
+	return float64(reused) / float64(fresh+reused)
+}
+
+// latencyPercentiles reads the requested percentiles off h, in milliseconds.
+func latencyPercentiles(ps []float64, h latencySketch) map[string]float64 {
+	out := make(map[string]float64, len(ps))
+	for i, v := range h.percentiles(ps) {
+		out[percentileLabel(ps[i])] = float64(v) / 1_000_000.0
+	}
+	return out
+}
+
+// histogramBuckets groups h into bars at the given bounds, or returns nil
+// if there are none.
+func histogramBuckets(bounds []time.Duration, h latencySketch) []HistogramBucket {
+	if len(bounds) == 0 {
+		return nil
+	}
+	ns := make([]uint64, len(bounds))
+	for i, b := range bounds {
+		ns[i] = uint64(b.Nanoseconds())
+	}
+	var (
+		out  []HistogramBucket
+		from float64
+	)
+	for i, n := range h.distribution(ns) {
+		b := HistogramBucket{FromMs: from, Count: n}
+		if i < len(ns) {
+			b.ToMs = float64(ns[i]) / 1_000_000.0
+			from = b.ToMs
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// LogReport prints the human-readable summary of r through the standard logger.
+func LogReport(cfg Config, r Report) {
+	if !cfg.NoBanner {
+		log.Printf("----------------------------------------------------------------------")
+	}
+	if r.Aborted {
+		log.Printf("🛑 Test aborted due to error spike after %.2f ms: more than %g%% of the last %d requests failed, partial results follow",
+			r.DurationMs, cfg.AbortErrorRate*100, cfg.AbortWindow)
+	} else if r.Interrupted {
+		log.Printf("⚠️ Test interrupted after %.2f ms, partial results follow", r.DurationMs)
+	} else {
+		log.Printf("✅ Test completed in %.2f ms", r.DurationMs)
+	}
+	if r.CapReached {
+		if cfg.Duration > 0 {
+			log.Printf("Stopped at MAX_REQUESTS (%d) before the %s deadline", cfg.MaxRequests, cfg.Duration)
+		} else {
+			log.Printf("Stopped at MAX_REQUESTS (%d)", cfg.MaxRequests)
+		}
+	}
+	if r.RampUpMs > 0 {
+		log.Printf("Ramp-up: workers started over %.2f ms", r.RampUpMs)
+	}
+	if r.Warmup > 0 {
+		log.Printf("Warm-up requests (excluded): %d", r.Warmup)
+	}
+	log.Printf("Total requests: %d", r.Total)
+	log.Printf("  -> Success ✅: %d", r.Success)
+	log.Printf("  -> Failure ❌: %d", r.Failure)
+	for c := range numFailureCategories {
+		if n := r.Failures[failureKeys[c]]; n > 0 {
+			log.Printf("       %s: %d", failureNames[c], n)
+		}
+	}
+	if f := r.FirstFailure; f != nil {
+		log.Printf("First failure: lowest-numbered failed request %d; %d of %d workers failed, first after %d-%d of their requests",
+			f.Request, f.Workers, cfg.Concurrency, f.WorkerMin, f.WorkerMax)
+	}
+	if r.Retries > 0 {
+		log.Printf("Retries: %d", r.Retries)
+	}
+	if len(r.GRPCCodes) > 0 {
+		names := make([]string, 0, len(r.GRPCCodes))
+		for name := range r.GRPCCodes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		log.Printf("gRPC status codes:")
+		for _, name := range names {
+			log.Printf("  %s: %d", name, r.GRPCCodes[name])
+		}
+	} else if len(r.StatusCodes) > 0 {
+		codes := make([]int, 0, len(r.StatusCodes))
+		for code := range r.StatusCodes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		log.Printf("Status codes:")
+		for _, code := range codes {
+			log.Printf("  %d %s: %d", code, http.StatusText(code), r.StatusCodes[code])
+		}
+	}
+	if len(r.Protocols) > 0 {
+		var protoOut []string
+		for _, name := range protoNames {
+			if n, ok := r.Protocols[name]; ok {
+				protoOut = append(protoOut, fmt.Sprintf("%s %d", name, n))
+			}
+		}
+		log.Printf("Protocols: %s", strings.Join(protoOut, " | "))
+	}
+	if r.MaxInflight > 0 {
+		log.Printf("Peak in-flight requests: %d (limit %d)", r.PeakInflight, r.MaxInflight)
+	} else {
+		log.Printf("Peak in-flight requests: %d", r.PeakInflight)
+	}
+	if r.ConnsNew+r.ConnsReused > 0 {
+		log.Printf("Connections: %d new, %d reused (%.1f%% reuse)", r.ConnsNew, r.ConnsReused, r.ReuseRatio*100)
+	}
+	if r.Redirected > 0 {
+		if cfg.FollowRedirects {
+			log.Printf("Redirects: %d requests redirected, %d hops followed (latency includes every hop)", r.Redirected, r.RedirectHops)
+		} else {
+			log.Printf("Redirects: %d requests answered with a redirect, not followed", r.Redirected)
+		}
+	}
+	if r.RateLimited > 0 {
+		log.Printf("⚠️ Rate limited: %d responses (%.1f%%) were 429 Too Many Requests", r.RateLimited, float64(r.RateLimited)/float64(max(r.Total, 1))*100)
+	}
+	if r.Oversized > 0 {
+		outcome := "truncated"
+		if cfg.OversizeResponse == "fail" {
+			outcome = "counted as failures"
+		}
+		log.Printf("⚠️ Oversized responses: %d bodies exceeded MAX_RESPONSE_BYTES (%d bytes) and were %s", r.Oversized, cfg.MaxResponseBytes, outcome)
+	}
+	if r.Abandoned > 0 {
+		log.Printf("⚠️ Drain timeout: %d requests were still in flight and were abandoned, they are not counted above", r.Abandoned)
+	}
+	if ra := r.RetryAfter; ra != nil && ra.Waits > 0 {
+		log.Printf("Retry-After honored: %d pauses, %.1f s in total", ra.Waits, ra.WaitedMs/1000)
+	}
+	if r.Late > 0 {
+		log.Printf("⚠️ Open model could not keep up: %d arrivals found all %d workers busy and were sent late", r.Late, cfg.Concurrency)
+	}
+	if len(r.RateSteps) > 0 {
+		log.Printf("Performance: ~%.2f requests/second (RPS), scheduled average %.2f RPS (%.1f%%)", r.RPS, r.TargetRPS, r.RPS/r.TargetRPS*100)
+	} else if r.TargetRPS > 0 {
+		log.Printf("Performance: ~%.2f requests/second (RPS), target %g RPS (%.1f%%)", r.RPS, r.TargetRPS, r.RPS/r.TargetRPS*100)
+	} else {
+		log.Printf("Performance: ~%.2f requests/second (RPS)", r.RPS)
+	}
+
+	var pctOut strings.Builder
+	for _, p := range cfg.Percentiles {
+		label := percentileLabel(p)
+		fmt.Fprintf(&pctOut, " | %s %.2f", label, r.Latency.Percentiles[label])
+	}
+	if r.HeadOnly {
+		log.Printf("Throughput: 0 bytes received, HEAD responses carry headers only")
+	} else {
+		log.Printf("Throughput: %d bytes received, ~%.2f MB/s, avg response %.0f bytes", r.Bytes, r.MBPerSec, r.AvgRespSize)
+	}
+	if r.WireBytes != r.Bytes && r.Bytes > 0 {
+		log.Printf("Compression: %d bytes on the wire, %.1f%% saved", r.WireBytes, (1-float64(r.WireBytes)/float64(r.Bytes))*100)
+	}
+	label := "Response times (ms)"
+	if r.Handshakes != nil {
+		label = "Message round trips (ms)"
+	}
+	if r.COCorrected {
+		label = strings.TrimSuffix(label, ")") + ", from scheduled start)"
+	}
+	log.Printf("%s: min %.2f | avg %.2f | max %.2f | stddev %.2f%s", label, r.Latency.Min, r.Latency.Avg, r.Latency.Max, r.Latency.StdDev, pctOut.String())
+	if h := r.Handshakes; h != nil {
+		var hsOut strings.Builder
+		for _, p := range cfg.Percentiles {
+			label := percentileLabel(p)
+			fmt.Fprintf(&hsOut, " | %s %.2f", label, h.Latency.Percentiles[label])
+		}
+		log.Printf("WebSocket connections: %d opened, %d failed", h.Opened, h.Failed)
+		log.Printf("Handshake times (ms): min %.2f | avg %.2f | max %.2f%s", h.Latency.Min, h.Latency.Avg, h.Latency.Max, hsOut.String())
+	}
+
+	if r.Timing != nil {
+		var timingOut []string
+		for _, name := range phaseNames {
+			if avg, ok := r.Timing[name]; ok {
+				timingOut = append(timingOut, fmt.Sprintf("%s %.2f", strings.ToUpper(name), avg))
+			}
+		}
+		log.Printf("Timing breakdown (avg ms, new connections only for DNS/connect/TLS): %s", strings.Join(timingOut, " | "))
+	}
+
+	if len(r.Histogram) > 0 {
+		logHistogram(r.Histogram)
+	}
+
+	if len(r.Targets) > 0 {
+		log.Printf("Per-target breakdown:")
+		for _, t := range r.Targets {
+			if t.Name != "" {
+				log.Printf("  %s (%s)", t.Name, t.URL)
+			} else {
+				log.Printf("  %s", t.URL)
+			}
+			log.Printf("    requests %d | success %d | failure %d | min %.2f | avg %.2f | max %.2f ms",
+				t.Total, t.Success, t.Failure, t.Latency.Min, t.Latency.Avg, t.Latency.Max)
+		}
+	}
+
+	if len(r.Threads) > 0 {
+		logThreads(r.Threads)
+	}
+
+	if res := r.Resources; res != nil {
+		log.Printf("Tester resources: peak %d goroutines | peak heap %.1f MB | %d GC cycles, %.2f ms paused | GOMAXPROCS %d of %d CPUs",
+			res.PeakGoroutines, float64(res.PeakHeapBytes)/1_000_000.0, res.GCCycles, res.GCPauseMs, res.MaxProcs, res.CPUs)
+	}
+
+	if len(r.Tokens) > 0 {
+		log.Printf("Per-token breakdown:")
+		for _, t := range r.Tokens {
+			log.Printf("  %s: requests %d | success %d | failure %d | throttled (429) %d",
+				t.Label, t.Total, t.Success, t.Failure, t.Throttled)
+		}
+	}
+
+	if s := r.Sequence; s != nil {
+		log.Printf("Payload sequence: %d full cycles of %d bodies (%d sent)", s.Cycles, s.Length, s.Sent)
+	}
+
+	if len(r.RateSteps) > 0 {
+		log.Printf("Rate schedule (target vs achieved):")
+		for i, s := range r.RateSteps {
+			if s.DurationMs == 0 {
+				log.Printf("  %d. %g RPS: not reached", i+1, s.TargetRPS)
+				continue
+			}
+			log.Printf("  %d. %g RPS for %s: %.2f RPS achieved (%.1f%%), %d requests",
+				i+1, s.TargetRPS, time.Duration(s.DurationMs)*time.Millisecond, s.AchievedRPS, s.AchievedRPS/s.TargetRPS*100, s.Requests)
+		}
+	}
+}
+
+// histogramBarWidth is the length of the longest bar in the histogram.
+const histogramBarWidth = 40
+
+// logHistogram prints the latency histogram as horizontal bars scaled to
+// the largest bucket.
+func logHistogram(buckets []HistogramBucket) {
+	var peak, total uint64
+	for _, b := range buckets {
+		peak = max(peak, b.Count)
+		total += b.Count
+	}
+	log.Printf("Latency histogram:")
+	for _, b := range buckets {
+		label := fmt.Sprintf("%g-%g ms", b.FromMs, b.ToMs)
+		if b.ToMs == 0 {
+			label = fmt.Sprintf(">= %g ms", b.FromMs)
+		}
+		var bar string
+		var pct float64
+		if peak > 0 {
+			bar = strings.Repeat("█", int(b.Count*histogramBarWidth/peak))
+			pct = float64(b.Count) / float64(total) * 100
+		}
+		log.Printf("  %14s | %-*s %d (%.1f%%)", label, histogramBarWidth, bar, b.Count, pct)
+	}
+}
+
+// logThreads prints the per-worker breakdown, then the spread between the
+// busiest and idlest worker and between the fastest and slowest, which shows
+// at a glance whether one worker was stuck on a slow connection.
+func logThreads(threads []ThreadReport) {
+	log.Printf("Per-thread breakdown:")
+	minReq, maxReq := threads[0].Total, threads[0].Total
+	minAvg, maxAvg := threads[0].Latency.Avg, threads[0].Latency.Avg
+	for _, t := range threads {
+		name := fmt.Sprintf("thread %2d", t.Thread)
+		if t.Agent != "" {
+			name = t.Agent + " " + name
+		}
+		var first string
+		if t.FirstFailure > 0 {
+			first = fmt.Sprintf(" | first failure on its request %d", t.FirstFailure)
+		}
+		log.Printf("  %s: requests %d | success %d | failure %d | min %.2f | avg %.2f | max %.2f | stddev %.2f ms%s",
+			name, t.Total, t.Success, t.Failure, t.Latency.Min, t.Latency.Avg, t.Latency.Max, t.Latency.StdDev, first)
+		minReq, maxReq = min(minReq, t.Total), max(maxReq, t.Total)
+		minAvg, maxAvg = min(minAvg, t.Latency.Avg), max(maxAvg, t.Latency.Avg)
+	}
+	log.Printf("  spread: %d-%d requests per thread, avg latency %.2f-%.2f ms", minReq, maxReq, minAvg, maxAvg)
+}
+
+// ThresholdsPassed checks r against the failure thresholds and SLAs in cfg,
+// logging every check and, if there were any, the overall verdict.
+func ThresholdsPassed(cfg Config, r Report) bool {
+	passed := true
+	if r.Aborted {
+		log.Printf("❌ Test aborted due to error spike (ABORT_ERROR_RATE %.2f%%)", cfg.AbortErrorRate*100)
+		passed = false
+	}
+	if cfg.MaxFailureRate >= 0 && r.FailureRate > cfg.MaxFailureRate {
+		log.Printf("❌ Failure rate %.2f%% exceeds MAX_FAILURE_RATE %.2f%%", r.FailureRate*100, cfg.MaxFailureRate*100)
+		passed = false
+	} else if cfg.MaxFailureRate >= 0 {
+		log.Printf("✅ Failure rate %.2f%% within %.2f%%", r.FailureRate*100, cfg.MaxFailureRate*100)
+	}
+	for _, s := range cfg.LatencySLAs {
+		label := percentileLabel(s.Percentile)
+		limit := float64(s.Max.Microseconds()) / 1000
+		actual, ok := r.Latency.Percentiles[label]
+		switch {
+		case !ok:
+			log.Printf("❌ SLA %s <= %.2f ms cannot be checked, the report has no %s", label, limit, label)
+			passed = false
+		case actual > limit:
+			log.Printf("❌ SLA %s <= %.2f ms breached: %.2f ms", label, limit, actual)
+			passed = false
+		default:
+			log.Printf("✅ SLA %s <= %.2f ms met: %.2f ms", label, limit, actual)
+		}
+	}
+	if len(cfg.LatencySLAs) > 0 || cfg.MaxFailureRate >= 0 {
+		if passed {
+			log.Printf("SLA verdict: PASS")
+		} else {
+			log.Printf("SLA verdict: FAIL")
+		}
+	}
+	return passed
+}
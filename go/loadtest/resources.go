@@ -0,0 +1,62 @@
+package loadtest
+
+import (
+	"runtime"
+	"time"
+)
+
+// resourceSampleInterval is how often RESOURCE_STATS samples the process.
+// runtime.ReadMemStats briefly stops the world, so it is not called on every
+// request.
+const resourceSampleInterval = 250 * time.Millisecond
+
+// ResourceStats is the tester's own footprint during the run, present when
+// RESOURCE_STATS is set. High values next to flat RPS suggest the tester
+// rather than the target was the bottleneck.
+type ResourceStats struct {
+	PeakGoroutines int     `json:"peak_goroutines"`
+	PeakHeapBytes  uint64  `json:"peak_heap_bytes"`
+	GCCycles       uint32  `json:"gc_cycles"`   // garbage collections during the run
+	GCPauseMs      float64 `json:"gc_pause_ms"` // total stop-the-world pause during the run
+	CPUs           int     `json:"cpus"`        // runtime.NumCPU of the tester
+	MaxProcs       int     `json:"gomaxprocs"`
+}
+
+// startResourceSampler samples goroutines and heap usage until stop is
+// called, which returns the peaks.
+func startResourceSampler() (stop func() *ResourceStats) {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	rs := &ResourceStats{CPUs: runtime.NumCPU(), MaxProcs: runtime.GOMAXPROCS(0)}
+	var last runtime.MemStats
+	sample := func() {
+		rs.PeakGoroutines = max(rs.PeakGoroutines, runtime.NumGoroutine())
+		runtime.ReadMemStats(&last)
+		rs.PeakHeapBytes = max(rs.PeakHeapBytes, last.HeapAlloc)
+	}
+	sample()
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(resourceSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				sample()
+				return
+			case <-ticker.C:
+				sample()
+			}
+		}
+	}()
+	return func() *ResourceStats {
+		close(done)
+		<-finished
+		rs.GCCycles = last.NumGC - before.NumGC
+		rs.GCPauseMs = float64(last.PauseTotalNs-before.PauseTotalNs) / 1_000_000.0
+		return rs
+	}
+}
@@ -0,0 +1,1488 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"maps"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+)
+
+// runState is the state shared by all workers of a single Run.
+type runState struct {
+	stats    *stats
+	reqCtx   context.Context // parent of every request, see worker
+	targets  *targetSet
+	limiter  *rate.Limiter // nil when TARGET_RPS is unset or paces arrivals in the open model
+	payloads []payload
+	csv      *csvWriter          // nil unless CSV_OUTPUT is set
+	jsonl    *jsonlWriter        // nil unless JSONL_OUTPUT is set
+	counter  uint64              // backs the {{.Counter}} template placeholder
+	seqNext  uint64              // index of the next PAYLOAD_SEQUENCE body, counting every cycle
+	setup    string              // value extracted by the setup request, see SETUP_URL
+	capped   atomic.Bool         // MAX_REQUESTS stopped the run before it would have ended
+	breaker  *breaker            // nil unless ABORT_ERROR_RATE is set
+	schema   *jsonschema.Schema  // nil unless RESPONSE_SCHEMA is set
+	inflight *semaphore.Weighted // nil unless MAX_INFLIGHT is set
+	series   *timeSeries         // nil unless TIMESERIES_FILE is set
+	capture  *captureWriter      // nil unless CAPTURE_FILE is set
+	schedule *schedule           // nil unless CORRECT_COORDINATED_OMISSION is set in the closed model
+	tokens   *tokenPool          // nil unless AUTH_TOKENS_FILE is set
+	headers  *headerPool         // nil unless HEADER_POOL_FILE is set
+	rates    *rateSchedule       // nil unless RATE_SCHEDULE is set
+	replay   *replay             // nil unless ACCESS_LOG_FILE is set
+	tlsConf  *tls.Config         // nil unless a TLS setting is configured, see newTLSConfig
+	grpc     *grpcMethod         // nil unless PROTOCOL=grpc
+	drain    *drain              // nil unless DRAIN_TIMEOUT is set
+
+	logRequests bool // false when per-request log lines are suppressed
+}
+
+// methodHasBody reports whether requests with the given method carry the payload.
+// GET, HEAD and DELETE are sent without a body.
+func methodHasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return false
+	}
+	return true
+}
+
+// bodyMethod returns the method of the first target whose requests carry the
+// run's shared payload, or "" if none do, e.g. because every target is read
+// with GET or brings its own scenario payload.
+func bodyMethod(cfg Config, ts *targetSet) string {
+	for _, t := range ts.list {
+		if m := t.requestMethod(cfg); methodHasBody(m) && t.payloads == nil {
+			return m
+		}
+	}
+	return ""
+}
+
+// headOnly reports whether every target is requested with HEAD.
+func headOnly(cfg Config, ts *targetSet) bool {
+	for _, t := range ts.list {
+		if t.requestMethod(cfg) != http.MethodHead {
+			return false
+		}
+	}
+	return true
+}
+
+// warnEmptyPatches logs a warning for every target sent with PATCH whose
+// payload is empty, since such a request cannot describe any change. It must
+// run before the payloads are encoded.
+func warnEmptyPatches(cfg Config, rs *runState) {
+	for _, t := range rs.targets.list {
+		if t.requestMethod(cfg) != http.MethodPatch {
+			continue
+		}
+		payloads := rs.payloads
+		if t.payloads != nil {
+			payloads = t.payloads
+		}
+		for _, p := range payloads {
+			if p.tmpl == nil && len(bytes.TrimSpace(p.body)) == 0 {
+				log.Printf("Warning: PATCH requests to %s will be sent with an empty body", t.url)
+				break
+			}
+		}
+	}
+}
+
+// isTimeout reports whether err was caused by a request exceeding REQUEST_TIMEOUT.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// timeoutLabel formats a timeout for the banner, where 0 means none.
+func timeoutLabel(d time.Duration) string {
+	if d == 0 {
+		return "none"
+	}
+	return d.String()
+}
+
+// requestLabel formats the request counter used in per-request log lines.
+// In duration mode there is no fixed total to report.
+func requestLabel(cfg Config, reqNum int) string {
+	if cfg.Duration > 0 {
+		return fmt.Sprintf("Request %3d", reqNum)
+	}
+	return fmt.Sprintf("Request %3d/%d", reqNum, cfg.TotalRequests)
+}
+
+// logResult writes the log line of a finished request: human-readable by
+// default, or as a structured slog record with LOG_FORMAT=json.
+func logResult(cfg Config, threadID, reqNum int, res result) {
+	if cfg.LogFormat == "json" {
+		attrs := []any{
+			"thread", threadID,
+			"request_num", reqNum,
+			"status", res.code,
+			"duration_ms", float64(res.latency.Microseconds()) / 1000,
+		}
+		if res.err != nil {
+			attrs = append(attrs, "error", fmt.Sprintf("%s: %v", res.errMsg, res.err))
+		} else if !res.ok {
+			attrs = append(attrs, "error", failureKeys[res.failure])
+		}
+		slog.Info("request", attrs...)
+		return
+	}
+	if res.err != nil {
+		log.Printf("Thread %2d | %s | %s: %v", threadID, requestLabel(cfg, reqNum), res.errMsg, res.err)
+	} else {
+		log.Printf("Thread %2d | %s | Status: %s", threadID, requestLabel(cfg, reqNum), res.status)
+	}
+}
+
+// logRetry writes the log line announcing a retry, in the format of logResult.
+func logRetry(cfg Config, threadID, reqNum, attempt int, backoff time.Duration, res result) {
+	if cfg.LogFormat == "json" {
+		slog.Info("retry",
+			"thread", threadID,
+			"request_num", reqNum,
+			"attempt", attempt,
+			"backoff_ms", float64(backoff.Microseconds())/1000,
+			"error", describe(res),
+		)
+		return
+	}
+	log.Printf("Thread %2d | %s | retry %d/%d in %s after %s", threadID, requestLabel(cfg, reqNum), attempt, cfg.MaxRetries, backoff, describe(res))
+}
+
+// startIntervalReporter logs a progress snapshot every interval until the
+// returned stop function is called.
+func startIntervalReporter(st *stats, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastTotal uint64
+		last := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				success := atomic.LoadUint64(&st.success)
+				failure := atomic.LoadUint64(&st.failure)
+				total := success + failure
+				rps := float64(total-lastTotal) / now.Sub(last).Seconds()
+				log.Printf("Progress | Requests: %d | Current RPS: %.2f | Success: %d | Failure: %d", total, rps, success, failure)
+				lastTotal, last = total, now
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// result is the outcome of a single attempt at sending a request.
+type result struct {
+	status  string                   // response status, empty if no response was received
+	code    int                      // response status code, 0 if no response was received
+	proto   string                   // response protocol, e.g. "HTTP/2.0"
+	bytes   int64                    // response body bytes read, after decompression
+	wire    int64                    // response body bytes as received on the wire
+	ok      bool                     // counted as a success
+	failure failureCategory          // why the attempt failed, when !ok
+	err     error                    // build or transport error, nil if a response was received
+	errMsg  string                   // how err is described in the per-request log
+	start   time.Time                // when the request was sent
+	latency time.Duration            // round trip time, zero if no response was received
+	phases  [numPhases]time.Duration // connection phase durations, only with TRACE_TIMING
+	gotConn bool                     // a connection was obtained for the request
+	reused  bool                     // that connection had served an earlier request
+	hops    int                      // redirects followed on the way to the response
+	over    bool                     // the body was longer than MAX_RESPONSE_BYTES and was not read in full
+	header  http.Header              // response headers, nil if no response was received
+	rpc     string                   // gRPC status code name, empty for HTTP
+
+	// Set when the attempt had to open a WebSocket connection first, see
+	// PROTOCOL=websocket; handshake is 0 if that failed.
+	dialed    bool
+	handshake time.Duration
+
+	dumpReq  []byte // request as sent, only for captured requests
+	dumpResp []byte // response head and truncated body, only for captured requests
+}
+
+// retryable reports whether a failed attempt may succeed if sent again:
+// network-level errors and 5xx responses are, 4xx responses and invalid
+// requests are not.
+func (r result) retryable() bool {
+	if r.ok {
+		return false
+	}
+	switch r.failure {
+	case failDNS, failConnect, failTimeout, failHTTP5xx:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns how long the Retry-After header of a 429 or 503
+// response asks the client to wait, or 0 if there is no such header. Both
+// the delay-seconds and the HTTP-date form are understood.
+func retryAfter(res result, now time.Time) time.Duration {
+	if res.code != http.StatusTooManyRequests && res.code != http.StatusServiceUnavailable {
+		return 0
+	}
+	v := strings.TrimSpace(res.header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// newRequest builds the request for tgt to url, its rendered URL, with the
+// configured auth and headers. A non-empty token replaces AUTH_TOKEN as the
+// bearer token, a non-empty key is sent as the IDEMPOTENCY_HEADER, and
+// pooled, the picks from HEADER_POOL_FILE, override HEADERS.
+func newRequest(cfg Config, tgt *target, url string, payload []byte, token, key string, pooled http.Header) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(tgt.requestMethod(cfg), url, body)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.basicAuth() {
+		req.SetBasicAuth(cfg.BasicAuthUser, cfg.BasicAuthPass)
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthToken)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", cfg.ContentType)
+		if cfg.CompressRequest {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if cfg.DecompressResponse {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	// Set even when empty: net/http then leaves the header out rather than
+	// sending its own default.
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range pooled {
+		req.Header[k] = v
+	}
+	for k, v := range tgt.headers {
+		req.Header.Set(k, v)
+	}
+	if key != "" {
+		req.Header.Set(cfg.IdempotencyHeader, key)
+	}
+	if cfg.HMACSecret != "" {
+		signRequest(cfg, req, payload, time.Now())
+	}
+	return req, nil
+}
+
+// dumpRequest renders req as it goes on the wire, with its body if body is
+// set. It must be called before the trace is attached, as dumping does a
+// fake round trip. That round trip adds the Accept-Encoding a default
+// transport would, which ours does not send, so it is stripped again.
+func dumpRequest(req *http.Request, body bool) []byte {
+	dump, _ := httputil.DumpRequestOut(req, body)
+	if req.Header.Get("Accept-Encoding") == "" {
+		dump = bytes.Replace(dump, []byte("Accept-Encoding: gzip\r\n"), nil, 1)
+	}
+	return dump
+}
+
+// exchange builds and sends one request, see newRequest, and classifies the
+// response. A successful response must also match schema, unless that is
+// nil. With capture set the request and response are dumped into the result
+// for CAPTURE_FILE.
+func exchange(ctx context.Context, client *http.Client, cfg Config, tgt *target, url string, payload []byte, token, key string, pooled http.Header, schema *jsonschema.Schema, capture bool) result {
+	req, err := newRequest(cfg, tgt, url, payload, token, key, pooled)
+	if err != nil {
+		return result{failure: failOther, err: err, errMsg: "build error", start: time.Now()}
+	}
+
+	var dumpReq []byte
+	if capture {
+		dumpReq = dumpRequest(req, true)
+	}
+
+	trace := &requestTrace{}
+	hops := new(int)
+	ctx = context.WithValue(ctx, redirectHopsKey{}, hops)
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace.clientTrace(cfg.TraceTiming)))
+
+	start := time.Now()
+	trace.start = start
+	resp, err := client.Do(req)
+	if err != nil {
+		res := result{failure: classifyError(err), err: err, errMsg: "send error", start: start, hops: *hops, dumpReq: dumpReq}
+		_, res.gotConn, res.reused = trace.result()
+		if isTimeout(err) {
+			res.errMsg = fmt.Sprintf("timeout after %s", cfg.RequestTimeout)
+		}
+		return res
+	}
+	wire := &countingReader{r: resp.Body}
+	var rd io.Reader = wire
+	if cfg.DecompressResponse {
+		rd = decodeBody(resp, wire)
+	}
+	if cfg.MaxResponseBytes > 0 {
+		// One byte past the limit tells a longer body from one that fits.
+		rd = io.LimitReader(rd, cfg.MaxResponseBytes+1)
+	}
+	var (
+		respBody []byte
+		n        int64
+		readErr  error
+	)
+	switch {
+	case req.Method == http.MethodHead:
+		// There is no body, so the latency ends with the response headers.
+	case cfg.ExpectBodyContains != "" || schema != nil || capture:
+		respBody, readErr = io.ReadAll(rd)
+		n = int64(len(respBody))
+	default:
+		n, readErr = io.Copy(io.Discard, rd)
+	}
+	// Closing a body that was not read to the end also drops the
+	// connection, so an oversized response is never reused.
+	resp.Body.Close()
+	over := cfg.MaxResponseBytes > 0 && n > cfg.MaxResponseBytes
+	if over {
+		n = cfg.MaxResponseBytes
+		respBody = respBody[:min(int64(len(respBody)), n)]
+	}
+
+	res := result{status: resp.Status, code: resp.StatusCode, proto: resp.Proto, bytes: n, wire: wire.n, start: start, latency: time.Since(start), hops: *hops, header: resp.Header, over: over}
+	res.phases, res.gotConn, res.reused = trace.result()
+	if capture {
+		head, _ := httputil.DumpResponse(resp, false)
+		res.dumpReq, res.dumpResp = dumpReq, append(head, truncateBody(respBody)...)
+	}
+	switch {
+	// A connection dropped or timed out mid-body is a failure whatever the
+	// status said.
+	case readErr != nil && isTimeout(readErr):
+		res.failure, res.err = failTimeout, readErr
+		res.errMsg = fmt.Sprintf("timeout after %s reading body (%s)", cfg.RequestTimeout, resp.Status)
+	case readErr != nil:
+		res.failure, res.err = failIncompleteBody, readErr
+		res.errMsg = fmt.Sprintf("incomplete body (%s)", resp.Status)
+	case !cfg.SuccessCodes[resp.StatusCode]:
+		res.failure = classifyStatus(resp.StatusCode)
+	case over && cfg.OversizeResponse == "fail":
+		res.failure = failOversized
+	case cfg.ExpectBodyContains != "" && !bytes.Contains(respBody, []byte(cfg.ExpectBodyContains)):
+		res.failure = failBodyMismatch
+	default:
+		if schema == nil {
+			res.ok = true
+		} else if err := validateBody(schema, respBody); err != nil {
+			res.failure, res.err = failSchemaViolation, err
+			res.errMsg = fmt.Sprintf("schema violation (%s)", resp.Status)
+		} else {
+			res.ok = true
+		}
+	}
+	return res
+}
+
+// redirectHopsKey is the context key of the *int that checkRedirect counts a
+// request's redirects in.
+type redirectHopsKey struct{}
+
+// isRedirect reports whether code asks the client to look elsewhere. 304 Not
+// Modified does not.
+func isRedirect(code int) bool {
+	return code >= 300 && code < 400 && code != http.StatusNotModified
+}
+
+// checkRedirect is the CheckRedirect policy of FOLLOW_REDIRECTS and
+// MAX_REDIRECTS. The latency of a followed request spans every hop, so the
+// hops are counted to tell such requests apart in the report.
+func checkRedirect(cfg Config) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !cfg.FollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > cfg.MaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+		}
+		if hops, ok := req.Context().Value(redirectHopsKey{}).(*int); ok {
+			*hops = len(via)
+		}
+		return nil
+	}
+}
+
+// localAddr returns the address connections of worker n are made from,
+// rotating through LOCAL_ADDR so that each address carries a share of the
+// ephemeral ports, or nil to let the system choose.
+func localAddr(cfg Config, n int) net.Addr {
+	if len(cfg.LocalAddrs) == 0 {
+		return nil
+	}
+	return &net.TCPAddr{IP: net.ParseIP(cfg.LocalAddrs[n%len(cfg.LocalAddrs)])}
+}
+
+// newTransport builds the HTTP transport used by a worker. tlsConfig is
+// the run's newTLSConfig, shared by all transports, and nil for the
+// defaults; local is the localAddr connections are made from.
+func newTransport(cfg Config, tlsConfig *tls.Config, local net.Addr) *http.Transport {
+	t := &http.Transport{
+		DisableKeepAlives:   !cfg.KeepAlive,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		ForceAttemptHTTP2:   cfg.HTTP2,
+		// Compression is negotiated by exchange itself (DECOMPRESS_RESPONSE)
+		// so that both on-wire and decoded sizes can be measured.
+		DisableCompression:    true,
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+	}
+	if cfg.ProxyURL != "" {
+		u, _ := url.Parse(cfg.ProxyURL) // checked by Validate
+		t.Proxy = http.ProxyURL(u)
+	}
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second, LocalAddr: local}
+	t.DialContext = dialer.DialContext
+	switch {
+	case cfg.UnixSocket != "":
+		// The URL still supplies the Host header and path for routing.
+		t.Proxy = nil
+		dialer.LocalAddr = nil // a TCP address cannot bind a Unix socket
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", cfg.UnixSocket)
+		}
+	case len(cfg.Resolve) > 0:
+		// Like curl --resolve: only the dialled address changes, so the Host
+		// header and TLS server name still come from the URL.
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if override, ok := cfg.Resolve[addr]; ok {
+				addr = override
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	t.TLSClientConfig = tlsConfig
+	return t
+}
+
+// worker sends one request for every job it receives until jobs is closed or
+// ctx is done. Requests are sent with rs.reqCtx, which outlives a DURATION
+// deadline so that the last ones complete, but not an interrupt.
+func worker(ctx context.Context, cfg Config, rs *runState, threadID int, rng *rand.Rand, jobs <-chan job, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	client := &http.Client{
+		Transport:     newTransport(cfg, rs.tlsConf, localAddr(cfg, threadID-1)),
+		CheckRedirect: checkRedirect(cfg),
+		Timeout:       cfg.RequestTimeout, // 0 disables the per-request timeout
+	}
+	if cfg.CookieJar {
+		// One jar per worker, so each behaves like a separate user session.
+		client.Jar, _ = cookiejar.New(nil) // only fails on invalid options
+	}
+	var conn *grpc.ClientConn
+	if rs.grpc != nil {
+		// One connection per worker, like the HTTP transport.
+		var err error
+		if conn, err = dialGRPC(cfg, rs.tlsConf, localAddr(cfg, threadID-1)); err != nil {
+			log.Printf("Thread %2d | %v", threadID, err)
+			return
+		}
+		defer conn.Close()
+	}
+	var ws *wsSession
+	if cfg.websocket() {
+		// One connection per worker, kept across messages.
+		ws = newWSSession(cfg, rs.tlsConf, localAddr(cfg, threadID-1))
+		defer ws.close()
+	}
+
+	st := rs.stats
+	var (
+		latencyVar welford
+		own        threadStats // this worker's share, see PER_THREAD_STATS
+	)
+	defer func() {
+		st.mergeVariance(latencyVar)
+		st.mergeFirstFailure(own.firstFailure)
+		if cfg.PerThreadStats {
+			st.mergeThread(threadID, own, latencyVar)
+		}
+	}()
+
+	vars := templateVars{rng: rng, counter: &rs.counter, setup: rs.setup}
+	var bodyBuf bytes.Buffer
+	nextPayload := func(tgt *target) []byte {
+		payloads := rs.payloads
+		if tgt.payloads != nil {
+			payloads = tgt.payloads
+		}
+		switch {
+		case !methodHasBody(tgt.requestMethod(cfg)) || len(payloads) == 0:
+			return nil
+		case tgt.payloads == nil && cfg.PayloadSequence != "":
+			// Shared by all workers, so the sequence is replayed in order
+			// across the run rather than once per worker.
+			i := atomic.AddUint64(&rs.seqNext, 1) - 1
+			return payloads[i%uint64(len(payloads))].render(vars, &bodyBuf)
+		case len(payloads) > 1:
+			return payloads[rng.Intn(len(payloads))].render(vars, &bodyBuf)
+		}
+		return payloads[0].render(vars, &bodyBuf)
+	}
+
+	// nextToken picks the bearer token for the next request, nil without
+	// AUTH_TOKENS_FILE. Retries reuse the token of the first attempt.
+	nextToken := func() *authToken {
+		if rs.tokens == nil {
+			return nil
+		}
+		return rs.tokens.next(rng)
+	}
+
+	// nextKey returns the idempotency key of the next request, empty without
+	// IDEMPOTENCY_HEADER. Retries reuse the key of the first attempt, as a
+	// client retrying the same operation would.
+	nextKey := func() string {
+		if !cfg.IdempotencyKey {
+			return ""
+		}
+		return uniqueUUID()
+	}
+
+	// nextHeaders picks the HEADER_POOL_FILE headers of the next request, nil
+	// without one. Retries reuse the headers of the first attempt.
+	nextHeaders := func() http.Header {
+		if rs.headers == nil {
+			return nil
+		}
+		return rs.headers.pick(rng)
+	}
+
+	reqCtx := rs.reqCtx
+	if rs.drain != nil {
+		reqCtx = rs.drain.reqCtx
+	}
+
+	// send is exchange bounded by MAX_INFLIGHT. It reports false if ctx
+	// ended while waiting for a slot, or the request was abandoned at
+	// DRAIN_TIMEOUT or cut short by an interrupt.
+	send := func(tgt *target, url string, payload []byte, tok *authToken, key string, pooled http.Header, capture bool) (result, bool) {
+		if rs.inflight != nil {
+			if err := rs.inflight.Acquire(ctx, 1); err != nil {
+				return result{}, false
+			}
+			defer rs.inflight.Release(1)
+		}
+		st.beginRequest()
+		defer st.endRequest()
+		var token string
+		if tok != nil {
+			token = tok.value
+		}
+		var res result
+		switch {
+		case rs.grpc != nil:
+			res = rs.grpc.exchange(reqCtx, conn, cfg, payload, token, pooled, rs.schema)
+		case ws != nil:
+			res = ws.exchange(reqCtx, cfg, tgt, url, payload, token, pooled, rs.schema)
+		default:
+			res = exchange(reqCtx, client, cfg, tgt, url, payload, token, key, pooled, rs.schema, capture)
+		}
+		return res, rs.drain == nil || !rs.drain.cancelled(res.err)
+	}
+
+	// Warm-up requests hit the target like any other but are left out of
+	// the stats, so cold-start effects don't skew the results.
+	warmupEnd := time.Now().Add(cfg.WarmupDuration)
+	for i := 0; i < cfg.WarmupRequests || time.Now().Before(warmupEnd); i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		if rs.limiter != nil {
+			if err := rs.limiter.Wait(ctx); err != nil {
+				return
+			}
+		}
+		tgt, path := rs.targets.next(rng), ""
+		if rs.replay != nil {
+			tgt, path = rs.replay.request(i + 1)
+		}
+		if _, ok := send(tgt, tgt.render(vars)+path, nextPayload(tgt), nextToken(), nextKey(), nextHeaders(), false); !ok {
+			return
+		}
+		atomic.AddUint64(&st.warmup, 1)
+	}
+
+	first := true
+	for j := range jobs {
+		reqNum := j.num
+		if ctx.Err() != nil {
+			return
+		}
+		if !first && !cfg.openModel() {
+			if think := thinkTime(cfg, rng); think > 0 {
+				select {
+				case <-time.After(think):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		first = false
+		if rs.schedule != nil {
+			// Paced by the schedule instead of the limiter, so that after a
+			// stall the worker catches up rather than staying behind.
+			j.due = rs.schedule.due(reqNum, time.Now())
+			if wait := time.Until(j.due); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+		} else if rs.limiter != nil {
+			if err := rs.limiter.Wait(ctx); err != nil {
+				return
+			}
+		}
+
+		tgt, path := rs.targets.next(rng), ""
+		if rs.replay != nil {
+			tgt, path = rs.replay.request(reqNum)
+		}
+		url := tgt.render(vars) + path
+		payload := nextPayload(tgt)
+
+		capture := rs.capture != nil && captured(reqNum, cfg.CaptureSampleRate)
+		tok, key, pooled := nextToken(), nextKey(), nextHeaders()
+		if rs.drain != nil {
+			rs.drain.taken(reqNum)
+		}
+		res, ok := send(tgt, url, payload, tok, key, pooled, capture)
+		if !ok {
+			return
+		}
+		retries := 0
+	retry:
+		for attempt := 1; attempt <= cfg.MaxRetries && res.retryable(); attempt++ {
+			backoff := cfg.RetryBackoff << (attempt - 1)
+			if cfg.HonorRetryAfter {
+				if wait := retryAfter(res, time.Now()); wait > backoff {
+					st.recordWait(wait)
+					backoff = wait
+				}
+			}
+			if rs.logRequests {
+				logRetry(cfg, threadID, reqNum, attempt, backoff, res)
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				break retry // the run is over, so the last attempt stands
+			}
+			atomic.AddUint64(&st.retries, 1)
+			retries++
+			if res, ok = send(tgt, url, payload, tok, key, pooled, capture); !ok {
+				return
+			}
+		}
+		if res.err != nil && rs.reqCtx.Err() != nil {
+			return // interrupted, the request is not counted
+		}
+
+		if cfg.CorrectCoordinatedOmission {
+			res.latency = correctedLatency(res, j.due)
+		}
+		if res.status != "" {
+			ns := uint64(res.latency.Nanoseconds())
+			st.recordLatency(ns)
+			tgt.recordLatency(ns)
+			latencyVar.add(float64(ns))
+			st.recordProto(res.proto)
+			st.recordResponse(res.code, res.bytes, res.wire)
+			if res.rpc != "" {
+				st.recordRPC(res.rpc)
+			}
+			st.recordPhases(res.phases)
+		}
+		if res.gotConn {
+			st.recordConn(res.reused)
+		}
+		if res.dialed {
+			st.handshakes.record(res.handshake)
+		}
+		if res.over {
+			atomic.AddUint64(&st.oversized, 1)
+		}
+		st.recordRedirects(res.hops, res.code)
+		if rs.series != nil {
+			rs.series.record(uint64(res.latency.Nanoseconds()), res.status != "", res.ok)
+		}
+		if rs.rates != nil {
+			rs.rates.record(time.Now())
+		}
+		if res.ok {
+			st.recordSuccess()
+		} else {
+			st.recordFailure(res.failure)
+			st.recordFirstFailure(uint64(reqNum))
+		}
+		tgt.recordResult(res.ok)
+		own.record(res.ok, res.status != "", uint64(res.latency.Nanoseconds()))
+		if tok != nil {
+			tok.recordResult(res.ok, res.code)
+		}
+		if rs.breaker != nil {
+			rs.breaker.record(res.ok)
+		}
+
+		if rs.csv != nil {
+			row := csvRow{thread: threadID, reqNum: reqNum, start: res.start, status: res.code, duration: res.latency}
+			if res.err != nil {
+				row.err = res.err.Error()
+			} else if !res.ok {
+				row.err = failureKeys[res.failure]
+			}
+			rs.csv.write(row)
+		}
+		if rs.jsonl != nil {
+			rs.jsonl.write(newJSONLRecord(cfg, threadID, reqNum, tgt, url, retries, res))
+		}
+		if capture {
+			rs.capture.write(threadID, reqNum, res)
+		}
+
+		if rs.logRequests {
+			logResult(cfg, threadID, reqNum, res)
+		}
+
+		// A throttled worker holds off as asked; the others carry on, so
+		// each backs off only as often as it is told to.
+		if cfg.HonorRetryAfter {
+			if wait := retryAfter(res, time.Now()); wait > 0 {
+				st.recordWait(wait)
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// thinkTime returns how long a worker pauses before its next request:
+// THINK_TIME, shifted by a uniformly random amount within ±THINK_TIME_JITTER.
+func thinkTime(cfg Config, rng *rand.Rand) time.Duration {
+	d := cfg.ThinkTime
+	if cfg.ThinkTimeJitter > 0 {
+		d += time.Duration(rng.Int63n(2*int64(cfg.ThinkTimeJitter)+1)) - cfg.ThinkTimeJitter
+	}
+	return max(d, 0)
+}
+
+// describe summarizes a failed attempt for retry log lines.
+func describe(res result) string {
+	if res.err != nil {
+		return res.errMsg
+	}
+	return res.status
+}
+
+// logBanner prints the effective configuration before the test starts.
+func logBanner(cfg Config, rs *runState) {
+	log.Printf("🚀 Starting load test (Go)...")
+	if cfg.Duration > 0 {
+		log.Printf("Concurrency: %d, Duration: %s", cfg.Concurrency, cfg.Duration)
+	} else {
+		log.Printf("Concurrency: %d, Total requests: %d", cfg.Concurrency, cfg.TotalRequests)
+	}
+	log.Printf("GOMAXPROCS: %d (%d CPUs)", runtime.GOMAXPROCS(0), runtime.NumCPU())
+	log.Printf("Seed: %d", cfg.Seed)
+	if cfg.ScenarioFile != "" {
+		log.Printf("Scenarios from %s (weighted):", cfg.ScenarioFile)
+		for _, t := range rs.targets.list {
+			log.Printf("  - %s: %d%% %s %s", t.name, t.weight*100/rs.targets.totalWeight, t.requestMethod(cfg), t.url)
+		}
+	} else if t := rs.targets.list[0]; cfg.RawRequestFile != "" {
+		log.Printf("Raw request from %s: %s %s with %d headers", cfg.RawRequestFile, t.method, t.url, len(t.headers))
+	} else if rs.replay != nil {
+		pace := "as fast as allowed"
+		if cfg.AccessLogTiming {
+			pace = "keeping the logged timing"
+		}
+		log.Printf("Replaying %d requests from %s against %s, %s", len(rs.replay.entries), cfg.AccessLogFile, t.url, pace)
+	} else if rs.grpc != nil {
+		transport := "plaintext"
+		if cfg.GRPCTLS || rs.tlsConf != nil {
+			transport = "TLS"
+		}
+		source := "server reflection"
+		if cfg.GRPCProtoset != "" {
+			source = cfg.GRPCProtoset
+		}
+		log.Printf("gRPC target: %s (%s), method %s, descriptors from %s", t.url, transport, rs.grpc.path, source)
+	} else if cfg.websocket() {
+		perConn := "the whole run"
+		if cfg.WSMessagesPerConn > 0 {
+			perConn = fmt.Sprintf("%d messages", cfg.WSMessagesPerConn)
+		}
+		log.Printf("WebSocket target: %s, one connection per worker kept for %s", t.url, perConn)
+	} else if len(rs.targets.list) == 1 {
+		log.Printf("Target URL: %s %s", cfg.Method, rs.targets.list[0].url)
+	} else {
+		log.Printf("Target URLs (%s, round-robin):", cfg.Method)
+		for _, t := range rs.targets.list {
+			log.Printf("  - %s", t.url)
+		}
+	}
+	if cfg.openModel() {
+		dist := "constant"
+		if cfg.Poisson {
+			dist = "Poisson"
+		}
+		at := fmt.Sprintf("%g RPS", cfg.TargetRPS)
+		if rs.rates != nil {
+			at = "the scheduled rate"
+		}
+		log.Printf("Arrival model: open at %s (%s), at most %d in flight", at, dist, cfg.Concurrency)
+	} else if rs.limiter != nil && rs.rates == nil {
+		log.Printf("Target RPS: %g", cfg.TargetRPS)
+	}
+	if rs.rates != nil {
+		log.Printf("Rate schedule (%d steps, %s):", len(cfg.RateSchedule), rs.rates.total())
+		for i, st := range cfg.RateSchedule {
+			log.Printf("  %d. %g RPS for %s", i+1, st.RPS, st.Duration)
+		}
+	}
+	if cfg.RampUp > 0 {
+		log.Printf("Ramp-up: %s", cfg.RampUp)
+	}
+	if cfg.RequestTimeout > 0 {
+		log.Printf("Request timeout: %s", cfg.RequestTimeout)
+	} else {
+		log.Println("Request timeout: None")
+	}
+	if cfg.DrainTimeout > 0 {
+		log.Printf("Drain timeout: %s for requests in flight when the run ends", cfg.DrainTimeout)
+	}
+	log.Printf("Transport timeouts: dial %s | TLS handshake %s | response header %s | idle connection %s",
+		timeoutLabel(cfg.DialTimeout), timeoutLabel(cfg.TLSHandshakeTimeout), timeoutLabel(cfg.ResponseHeaderTimeout), timeoutLabel(cfg.IdleConnTimeout))
+	if cfg.InsecureSkipVerify {
+		log.Println("⚠️ WARNING: TLS certificate verification is DISABLED (INSECURE_SKIP_VERIFY). Do not use for production benchmarks.")
+	}
+	if cfg.ClientCert != "" {
+		log.Printf("Client certificate: %s (mutual TLS)", cfg.ClientCert)
+	}
+	if cfg.CACert != "" {
+		log.Printf("Extra CA certificate: %s", cfg.CACert)
+	}
+	if cfg.HTTP2 {
+		log.Println("HTTP/2: Attempted (negotiated via TLS ALPN)")
+	}
+	if cfg.KeepAlive {
+		log.Printf("Keep-alive: On (max idle conns/host: %d)", cfg.MaxIdleConnsPerHost)
+	} else {
+		log.Println("Keep-alive: Off")
+	}
+	if cfg.FollowRedirects {
+		log.Printf("Redirects: followed, up to %d", cfg.MaxRedirects)
+	} else {
+		log.Println("Redirects: not followed, 3xx responses are recorded as they are")
+	}
+	if cfg.CookieJar {
+		log.Printf("Cookies: kept per worker session")
+	}
+	if cfg.HMACSecret != "" {
+		log.Printf("Signing: HMAC-%s of timestamp + body in %s (%s), timestamp in %s",
+			strings.ToUpper(cfg.HMACAlgorithm), cfg.HMACHeader, cfg.HMACEncoding, cfg.HMACTimestampHeader)
+	}
+	if cfg.IdempotencyKey {
+		log.Printf("Idempotency key: fresh UUID per request in %s, reused by retries", cfg.IdempotencyHeader)
+	}
+	if len(cfg.Headers) > 0 {
+		log.Printf("Extra headers: %d", len(cfg.Headers))
+	}
+	if rs.headers != nil {
+		log.Printf("Header pool: %s from %s, one value each picked at random per request", strings.Join(rs.headers.names, ", "), cfg.HeaderPoolFile)
+	}
+	if cfg.LatencyAlgo == "tdigest" {
+		log.Println("Latency percentiles: streaming t-digest (LATENCY_ALGO=tdigest)")
+	}
+	if cfg.MaxResponseBytes > 0 {
+		outcome := "are truncated"
+		if cfg.OversizeResponse == "fail" {
+			outcome = "fail"
+		}
+		log.Printf("Response bodies: read up to %d bytes, longer ones %s", cfg.MaxResponseBytes, outcome)
+	}
+	switch {
+	case rs.payloads == nil && cfg.RawRequestFile != "" && rs.targets.list[0].payloads != nil:
+		log.Printf("Payload: %d bytes from the raw request", rs.targets.list[0].payloads[0].rawSize)
+	case rs.payloads == nil && cfg.ScenarioFile != "":
+		log.Println("Payload: only the bodies of scenarios that have one")
+	case rs.payloads == nil:
+		log.Println("Payload: none, every request is sent without a body")
+	case cfg.PayloadSequence != "":
+		log.Printf("Payloads: sequence of %d from %s, replayed in order", len(rs.payloads), cfg.PayloadSequence)
+	case cfg.PayloadSize > 0:
+		log.Printf("Payload: %d bytes generated (PAYLOAD_SIZE)", rs.payloads[0].rawSize)
+	case cfg.PayloadDir != "":
+		log.Printf("Payloads: %d files from %s", len(rs.payloads), cfg.PayloadDir)
+	case cfg.PayloadFile == "-":
+		log.Printf("Payload: %d bytes from stdin", len(rs.payloads[0].body))
+	}
+	if cfg.ContentType != "application/json" {
+		log.Printf("Content-Type: %s", cfg.ContentType)
+	}
+	if cfg.MultipartFile != "" {
+		log.Printf("Multipart upload: %s as field %q", cfg.MultipartFile, cfg.MultipartField)
+	}
+	if cfg.CompressRequest {
+		var raw, compressed int
+		for _, p := range rs.payloads {
+			if p.tmpl == nil {
+				raw += p.rawSize
+				compressed += len(p.body)
+			}
+		}
+		if compressed > 0 {
+			log.Printf("Compression: gzip, %d -> %d bytes (ratio %.2fx)", raw, compressed, float64(raw)/float64(compressed))
+		} else {
+			log.Println("Compression: gzip, templated payloads compressed per request")
+		}
+	}
+	if cfg.SetupURL != "" {
+		log.Printf("Setup: %s %s, extracted %d bytes", cfg.SetupMethod, cfg.SetupURL, len(rs.setup))
+	}
+	if cfg.ResponseSchema != "" {
+		log.Printf("Response schema: %s", cfg.ResponseSchema)
+	}
+	if cfg.ExpectBodyContains != "" {
+		log.Printf("Expected body substring: %q", cfg.ExpectBodyContains)
+	}
+	switch {
+	case cfg.basicAuth():
+		log.Printf("Auth: Basic (user %s, password hidden)", cfg.BasicAuthUser)
+	case rs.tokens != nil:
+		order := "round-robin"
+		if rs.tokens.random {
+			order = "random"
+		}
+		log.Printf("Auth: %d bearer tokens from %s (%s, hidden)", len(rs.tokens.list), cfg.AuthTokensFile, order)
+	case cfg.AuthToken == "":
+		log.Println("Auth Token: Not set")
+	default:
+		log.Println("Auth Token: Set (hidden)")
+	}
+	if cfg.MetricsAddr != "" {
+		log.Printf("Metrics: http://%s/metrics", cfg.MetricsAddr)
+	}
+	if cfg.DashboardAddr != "" {
+		log.Printf("Dashboard: http://%s/", cfg.DashboardAddr)
+	}
+	if cfg.StatsdAddr != "" {
+		log.Printf("Push metrics: statsd %s, prefix %s", cfg.StatsdAddr, cfg.MetricsPrefix)
+	}
+	if cfg.OTLPEndpoint != "" {
+		log.Printf("Push metrics: OTLP %s, prefix %s", cfg.OTLPEndpoint, cfg.MetricsPrefix)
+	}
+	if cfg.ProxyURL != "" {
+		u, _ := url.Parse(cfg.ProxyURL)
+		log.Printf("Proxy: %s", u.Redacted())
+	}
+	if cfg.UnixSocket != "" {
+		log.Printf("Unix socket: %s", cfg.UnixSocket)
+	} else if len(cfg.Resolve) > 0 {
+		hosts := make([]string, 0, len(cfg.Resolve))
+		for host := range cfg.Resolve {
+			hosts = append(hosts, host)
+		}
+		slices.Sort(hosts)
+		for _, host := range hosts {
+			log.Printf("Resolve: %s -> %s", host, cfg.Resolve[host])
+		}
+	}
+	switch {
+	case len(cfg.LocalAddrs) > 1:
+		log.Printf("Local addresses (rotated across workers): %s", strings.Join(cfg.LocalAddrs, ", "))
+	case len(cfg.LocalAddrs) == 1:
+		log.Printf("Local address: %s", cfg.LocalAddrs[0])
+	}
+	if cfg.PprofAddr != "" {
+		log.Printf("Profiling: http://%s/debug/pprof/", cfg.PprofAddr)
+	}
+	if cfg.CSVOutput != "" {
+		log.Printf("CSV output: %s", cfg.CSVOutput)
+	}
+	if cfg.JSONLOutput != "" {
+		log.Printf("JSON Lines output: %s", cfg.JSONLOutput)
+	}
+	if cfg.CaptureFile != "" {
+		log.Printf("Capture: %g%% of requests to %s", cfg.CaptureSampleRate*100, cfg.CaptureFile)
+	}
+	if cfg.TimeSeriesFile != "" {
+		log.Printf("Time series: every %s to %s", cfg.TimeSeriesInterval, cfg.TimeSeriesFile)
+	}
+	if cfg.WarmupRequests > 0 || cfg.WarmupDuration > 0 {
+		log.Printf("Warm-up: %d requests / %s per thread (excluded from stats)", cfg.WarmupRequests, cfg.WarmupDuration)
+	}
+	if cfg.ThinkTime > 0 || cfg.ThinkTimeJitter > 0 {
+		log.Printf("Think time: %s ± %s", cfg.ThinkTime, cfg.ThinkTimeJitter)
+	}
+	if cfg.MaxInflight > 0 {
+		log.Printf("Max in-flight requests: %d", cfg.MaxInflight)
+	}
+	if cfg.AbortErrorRate > 0 {
+		log.Printf("Abort: failure rate above %g%% over the last %d requests", cfg.AbortErrorRate*100, cfg.AbortWindow)
+	}
+	if cfg.CorrectCoordinatedOmission {
+		log.Printf("Latency: measured from each request's scheduled start at %g RPS (coordinated omission corrected)", cfg.TargetRPS)
+	}
+	if cfg.ResourceStats {
+		log.Printf("Resource stats: goroutines and heap sampled every %s", resourceSampleInterval)
+	}
+	if cfg.MaxRequests > 0 {
+		log.Printf("Request cap: %d", cfg.MaxRequests)
+	}
+	if cfg.MaxRetries > 0 {
+		log.Printf("Retries: up to %d with %s exponential backoff", cfg.MaxRetries, cfg.RetryBackoff)
+	}
+	if cfg.HonorRetryAfter {
+		log.Printf("Retry-After: honored on 429 and 503 responses, pausing the worker")
+	}
+	log.Printf("----------------------------------------------------------------------")
+}
+
+// prepare validates cfg and loads everything a run needs before it sends
+// traffic: the targets, payloads, response schema and tokens. It returns cfg
+// with the final Content-Type, which may carry a multipart boundary.
+func prepare(cfg Config) (Config, *runState, error) {
+	if err := cfg.Validate(); err != nil {
+		return cfg, nil, err
+	}
+	rs := &runState{}
+	if cfg.ScenarioFile != "" {
+		scenarios, err := loadScenarios(cfg.ScenarioFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+		rs.targets = newScenarioSet(scenarios)
+	} else if cfg.RawRequestFile != "" {
+		t, err := loadRawRequest(cfg.RawRequestFile, cfg.TargetURL)
+		if err != nil {
+			return cfg, nil, err
+		}
+		rs.targets = &targetSet{list: []*target{t}}
+	} else if cfg.AccessLogFile != "" {
+		entries, err := loadAccessLog(cfg.AccessLogFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+		if rs.replay, rs.targets, err = newReplay(entries, cfg.BaseURL, cfg.AccessLogTiming); err != nil {
+			return cfg, nil, err
+		}
+		if cfg.Duration == 0 && cfg.TotalRequests == 0 {
+			cfg.TotalRequests = len(entries) // replay the log once
+		}
+	} else if cfg.grpc() || cfg.websocket() {
+		// Every call or message carries the payload, whatever HTTP_METHOD
+		// says.
+		t, err := newTarget(cfg.TargetURL)
+		if err != nil {
+			return cfg, nil, err
+		}
+		t.method = http.MethodPost
+		rs.targets = &targetSet{list: []*target{t}}
+	} else {
+		urls, err := loadTargetURLs(cfg.TargetURLs, cfg.TargetURL)
+		if err != nil {
+			return cfg, nil, err
+		}
+		if rs.targets, err = newTargetSet(urls); err != nil {
+			return cfg, nil, err
+		}
+	}
+	var err error
+	method := bodyMethod(cfg, rs.targets)
+	switch {
+	case method == "":
+		// Nothing sends the shared payload, so it need not exist.
+	case cfg.PayloadSequence != "":
+		if rs.payloads, err = loadPayloadSequence(cfg.PayloadSequence); err != nil {
+			return cfg, nil, err
+		}
+	case cfg.PayloadSize > 0:
+		rs.payloads = []payload{generatePayload(cfg.PayloadSize, cfg.Seed)}
+	default:
+		if rs.payloads, err = loadPayloads(cfg.PayloadDir, cfg.PayloadFile); err != nil {
+			if errors.Is(err, fs.ErrNotExist) && cfg.PayloadDir == "" {
+				return cfg, nil, fmt.Errorf("%s requests need a body, but %s does not exist: create it, or set PAYLOAD_FILE, PAYLOAD_DIR or PAYLOAD_SIZE", method, cfg.PayloadFile)
+			}
+			return cfg, nil, err
+		}
+	}
+	if cfg.ResponseSchema != "" {
+		if rs.schema, err = loadSchema(cfg.ResponseSchema); err != nil {
+			return cfg, nil, err
+		}
+	}
+	if cfg.AuthTokensFile != "" && !cfg.basicAuth() {
+		if rs.tokens, err = loadTokens(cfg.AuthTokensFile, cfg.AuthTokensRandom); err != nil {
+			return cfg, nil, err
+		}
+	}
+	if cfg.HeaderPoolFile != "" {
+		if rs.headers, err = loadHeaderPool(cfg.HeaderPoolFile); err != nil {
+			return cfg, nil, err
+		}
+	}
+	if rs.tlsConf, err = newTLSConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if cfg.grpc() {
+		if rs.grpc, err = loadGRPCMethod(cfg, rs.tlsConf); err != nil {
+			return cfg, nil, err
+		}
+		for _, p := range rs.payloads {
+			if p.tmpl != nil {
+				continue // checked when rendered
+			}
+			if err := rs.grpc.checkPayload(p.body); err != nil {
+				return cfg, nil, err
+			}
+		}
+	}
+	warnEmptyPatches(cfg, rs)
+	enc, contentType, err := newBodyEncoding(cfg)
+	if err != nil {
+		return cfg, nil, err
+	}
+	if enc != nil {
+		encodePayloads(rs.payloads, enc)
+		for _, t := range rs.targets.list {
+			encodePayloads(t.payloads, enc)
+		}
+	}
+	cfg.ContentType = contentType // carries the multipart boundary
+	if len(cfg.RateSchedule) > 0 {
+		// The schedule starts at its first step's rate and, without a
+		// DURATION, lasts as long as its steps do.
+		rs.rates = newRateSchedule(cfg.RateSchedule)
+		cfg.TargetRPS = cfg.RateSchedule[0].RPS
+		if cfg.Duration == 0 {
+			cfg.Duration = rs.rates.total()
+		}
+	}
+	return cfg, rs, nil
+}
+
+// Run executes a complete load test described by cfg and returns its report.
+// Cancelling ctx cancels the requests in flight; the report then covers the
+// requests that completed and is marked as interrupted. An error is returned
+// only if the test could not be started.
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	cfg, rs, err := prepare(cfg)
+	if err != nil {
+		return Report{}, err
+	}
+	warnFileLimit(cfg)
+	if cfg.SetupURL != "" {
+		value, err := runSetup(cfg, rs.tlsConf)
+		if err != nil {
+			return Report{}, fmt.Errorf("setup request %s %s failed: %w", cfg.SetupMethod, cfg.SetupURL, err)
+		}
+		rs.setup = value
+		if cfg.SetupHeader != "" {
+			key, value, _ := strings.Cut(cfg.SetupHeader, ":")
+			headers := make(map[string]string, len(cfg.Headers)+1)
+			maps.Copy(headers, cfg.Headers)
+			headers[http.CanonicalHeaderKey(strings.TrimSpace(key))] = strings.ReplaceAll(strings.TrimSpace(value), "{{.Setup}}", rs.setup)
+			cfg.Headers = headers
+		}
+	}
+	showProgress := cfg.Progress && isTerminal(os.Stderr)
+	rs.logRequests = !cfg.Quiet && !showProgress
+	if cfg.MaxInflight > 0 {
+		rs.inflight = semaphore.NewWeighted(int64(cfg.MaxInflight))
+	}
+	if cfg.TargetRPS > 0 && !cfg.openModel() {
+		rs.limiter = rate.NewLimiter(rate.Limit(cfg.TargetRPS), 1)
+	}
+	if cfg.CorrectCoordinatedOmission && !cfg.openModel() {
+		rs.schedule = newSchedule(cfg.TargetRPS)
+	}
+	if cfg.DrainTimeout > 0 {
+		rs.drain = newDrain(ctx, cfg)
+	}
+
+	if cfg.CSVOutput != "" {
+		w, err := newCSVWriter(cfg.CSVOutput)
+		if err != nil {
+			return Report{}, fmt.Errorf("cannot create CSV output: %w", err)
+		}
+		rs.csv = w
+		defer func() {
+			if err := w.close(); err != nil {
+				log.Printf("Warning: could not finish writing %s: %v", cfg.CSVOutput, err)
+			}
+		}()
+	}
+
+	if cfg.JSONLOutput != "" {
+		w, err := newJSONLWriter(cfg.JSONLOutput)
+		if err != nil {
+			return Report{}, fmt.Errorf("cannot create JSON Lines output: %w", err)
+		}
+		rs.jsonl = w
+		defer func() {
+			if err := w.close(); err != nil {
+				log.Printf("Warning: could not finish writing %s: %v", cfg.JSONLOutput, err)
+			}
+		}()
+	}
+
+	if cfg.CaptureFile != "" {
+		w, err := newCaptureWriter(cfg.CaptureFile)
+		if err != nil {
+			return Report{}, fmt.Errorf("cannot create capture file: %w", err)
+		}
+		rs.capture = w
+		defer func() {
+			if err := w.close(); err != nil {
+				log.Printf("Warning: could not finish writing %s: %v", cfg.CaptureFile, err)
+			}
+		}()
+	}
+	if cfg.TimeSeriesFile != "" {
+		ts, err := newTimeSeries(cfg.TimeSeriesFile)
+		if err != nil {
+			return Report{}, fmt.Errorf("cannot create time series output: %w", err)
+		}
+		rs.series = ts
+	}
+
+	if !cfg.NoBanner {
+		logBanner(cfg, rs)
+	}
+
+	var metrics *promMetrics
+	if cfg.MetricsAddr != "" {
+		var stopMetrics func()
+		metrics, stopMetrics = startMetricsServer(cfg.MetricsAddr)
+		defer stopMetrics()
+	}
+	rs.stats = newStats(cfg, metrics)
+	if cfg.PprofAddr != "" {
+		defer startPprofServer(cfg.PprofAddr)()
+	}
+
+	start := time.Now()
+	if cfg.DashboardAddr != "" {
+		defer startDashboard(cfg.DashboardAddr, rs.stats, cfg.reportedPercentiles(), start)()
+	}
+
+	rs.reqCtx = ctx
+	parent := ctx
+	if cfg.AbortErrorRate > 0 {
+		var abort context.CancelFunc
+		ctx, abort = context.WithCancel(ctx)
+		defer abort()
+		rs.breaker = newBreaker(cfg.AbortWindow, cfg.AbortErrorRate, abort)
+	}
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(cfg.Duration))
+		defer cancel()
+	}
+
+	if rs.rates != nil {
+		rs.rates.begin(ctx, start, rs.limiter, !cfg.NoBanner)
+	}
+	if rs.series != nil {
+		rs.series.begin(cfg.TimeSeriesInterval, start)
+		defer func() {
+			if err := rs.series.close(); err != nil {
+				log.Printf("Warning: could not finish writing %s: %v", cfg.TimeSeriesFile, err)
+			}
+		}()
+	}
+
+	var stopResources func() *ResourceStats
+	if cfg.ResourceStats {
+		stopResources = startResourceSampler()
+	}
+	stopReporter := func() {}
+	if cfg.ReportInterval > 0 {
+		stopReporter = startIntervalReporter(rs.stats, cfg.ReportInterval)
+	}
+	stopProgress := func() {}
+	if showProgress {
+		stopProgress = startProgressBar(cfg, rs.stats, start)
+	}
+
+	// Jobs are request numbers handed out to whichever worker is free, so the
+	// total volume is independent of the number of workers. Being the only
+	// source of request numbers, the producer also enforces MAX_REQUESTS.
+	//
+	// In the open model the producer also sets the pace: jobs are sent on an
+	// unbuffered channel at TARGET_RPS whether or not earlier requests have
+	// completed, so the workers only act as the in-flight limit. An arrival
+	// that finds them all busy is counted as late and sent as soon as one
+	// frees up; later arrivals catch up to keep the overall rate. With
+	// POISSON the gaps are exponentially distributed around the same mean,
+	// which gives bursty traffic at the correct average rate.
+	jobs := make(chan job, cfg.Concurrency)
+	var interval time.Duration
+	if cfg.openModel() {
+		jobs = make(chan job)
+		interval = time.Duration(float64(time.Second) / cfg.TargetRPS)
+	}
+	// All randomness derives from SEED: a root source hands out the seeds of
+	// the producer's and every worker's own source, since a *rand.Rand is not
+	// safe for concurrent use. The same SEED and configuration therefore
+	// always draw the same values.
+	root := rand.New(rand.NewSource(cfg.Seed))
+	arrivals := rand.New(rand.NewSource(root.Int63()))
+	workerRngs := make([]*rand.Rand, cfg.Concurrency)
+	for i := range workerRngs {
+		workerRngs[i] = rand.New(rand.NewSource(root.Int63()))
+	}
+	go func() {
+		defer close(jobs)
+		next := time.Now()
+		for n := 1; cfg.Duration > 0 || n <= cfg.TotalRequests; n++ {
+			if cfg.MaxRequests > 0 && n > cfg.MaxRequests {
+				rs.capped.Store(true)
+				return
+			}
+			j := job{num: n}
+			if rs.replay != nil && cfg.AccessLogTiming {
+				if wait := time.Until(start.Add(rs.replay.offset(n))); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			if interval > 0 {
+				if wait := time.Until(next); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return
+					}
+				}
+				j.due = next
+				if rs.rates != nil {
+					interval = time.Duration(float64(time.Second) / rs.rates.rpsAt(next.Sub(start)))
+				}
+				if cfg.Poisson {
+					next = next.Add(time.Duration(arrivals.ExpFloat64() * float64(interval)))
+				} else {
+					next = next.Add(interval)
+				}
+				select {
+				case jobs <- j:
+					continue
+				default:
+					atomic.AddUint64(&rs.stats.late, 1)
+				}
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	// With RAMP_UP set, workers are launched evenly spaced across the window
+	// instead of all at once.
+	rampStep := cfg.RampUp / time.Duration(max(cfg.Concurrency, 1))
+launch:
+	for i := range cfg.Concurrency {
+		if i > 0 && rampStep > 0 {
+			select {
+			case <-time.After(rampStep):
+			case <-ctx.Done():
+				break launch
+			}
+		}
+		wg.Add(1)
+		go worker(ctx, cfg, rs, i+1, workerRngs[i], jobs, &wg)
+	}
+
+	if rs.drain != nil {
+		finished := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(finished)
+		}()
+		rs.drain.wait(ctx, finished, cfg.DrainTimeout, rs.stats, !cfg.NoBanner)
+	}
+	wg.Wait()
+	stopProgress()
+	stopReporter()
+
+	r := buildReport(cfg, rs, time.Since(start), parent.Err() != nil)
+	if stopResources != nil {
+		r.Resources = stopResources()
+	}
+	return r, nil
+}
@@ -0,0 +1,606 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig is the configuration of a run of the given number of requests
+// against url, spread over workers, with a small payload and the log output
+// discarded.
+func testConfig(t *testing.T, url string, workers, requests int) Config {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	cfg := DefaultConfig()
+	cfg.TargetURL = url
+	cfg.PayloadFile = writeTestFile(t, "payload.json", `{"id":1}`)
+	cfg.Concurrency, cfg.TotalRequests = workers, requests
+	cfg.Quiet = true
+	return cfg
+}
+
+// runTest runs cfg, failing the test if the run cannot start.
+func runTest(t *testing.T, cfg Config) Report {
+	t.Helper()
+	r, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// writeTestFile writes content to a file of the given name in a temporary
+// directory and returns its path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int // the answer to the first failures attempts, 200 after
+		failures    int64
+		wantRetries uint64
+		wantSuccess uint64
+	}{
+		{"recovers", http.StatusServiceUnavailable, 2, 2, 1},
+		{"gives up", http.StatusServiceUnavailable, 10, 3, 0},
+		{"4xx not retried", http.StatusNotFound, 10, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= tt.failures {
+					w.WriteHeader(tt.status)
+				}
+			}))
+			defer srv.Close()
+
+			cfg := testConfig(t, srv.URL, 1, 1)
+			cfg.MaxRetries, cfg.RetryBackoff = 3, time.Millisecond
+			r := runTest(t, cfg)
+			if r.Retries != tt.wantRetries || r.Success != tt.wantSuccess || r.Total != 1 {
+				t.Errorf("retries %d, success %d of %d, want %d retries and %d of 1", r.Retries, r.Success, r.Total, tt.wantRetries, tt.wantSuccess)
+			}
+			if got := attempts.Load(); got != int64(tt.wantRetries)+1 {
+				t.Errorf("the server got %d attempts, want %d", got, tt.wantRetries+1)
+			}
+		})
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	var n atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 1, 4)
+	cfg.CSVOutput = filepath.Join(t.TempDir(), "results.csv")
+	runTest(t, cfg)
+
+	f, err := os.Open(cfg.CSVOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || !slices.Equal(rows[0], []string{"thread", "request_num", "timestamp", "status", "duration_ms", "error"}) {
+		t.Fatalf("rows %q, want the header and one row per request", rows)
+	}
+	for i, row := range rows[1:] {
+		wantStatus, wantErr := "200", ""
+		if i == 1 {
+			wantStatus, wantErr = "500", "http_5xx"
+		}
+		if row[1] != strconv.Itoa(i+1) || row[3] != wantStatus || row[5] != wantErr {
+			t.Errorf("row %d is %q, want request %d with status %s and error %q", i+1, row, i+1, wantStatus, wantErr)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, row[2]); err != nil {
+			t.Errorf("row %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestPayloadTemplate(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 2, 6)
+	cfg.PayloadFile = writeTestFile(t, "payload.json", `{"n":{{.Counter}},"id":"{{.UUID}}"}`)
+	runTest(t, cfg)
+
+	var counters []int
+	for _, b := range bodies {
+		var got struct {
+			N  int    `json:"n"`
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(b), &got); err != nil || len(got.ID) != 36 {
+			t.Fatalf("body %q is not the rendered template", b)
+		}
+		counters = append(counters, got.N)
+	}
+	slices.Sort(counters)
+	if want := []int{1, 2, 3, 4, 5, 6}; !slices.Equal(counters, want) {
+		t.Errorf("counters %v, want each of %v once", counters, want)
+	}
+}
+
+// blockingServer answers requests at once except the nth, which it holds
+// until the client gives up on it or the test ends. blocked is closed when
+// the nth arrives.
+func blockingServer(t *testing.T, nth int64) (url string, blocked <-chan struct{}) {
+	var n atomic.Int64
+	ch, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) // the server only notices a closed connection once the body is read
+		if n.Add(1) == nth {
+			close(ch)
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	return srv.URL, ch
+}
+
+func TestInterrupt(t *testing.T) {
+	url, blocked := blockingServer(t, 4)
+	cfg := testConfig(t, url, 1, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-blocked
+		cancel()
+	}()
+
+	start := time.Now()
+	r, err := Run(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the run took %s to return, want the request in flight cancelled", elapsed)
+	}
+	if !r.Interrupted || r.Total != 3 || r.Failure != 0 {
+		t.Errorf("interrupted %t with %d requests and %d failures, want an interrupted run of the 3 completed ones", r.Interrupted, r.Total, r.Failure)
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		key := r.Method + " " + r.URL.Path
+		if r.URL.Path == "/like" {
+			key += " " + r.Header.Get("X-Client") + " " + string(body)
+		}
+		mu.Lock()
+		seen[key]++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 2, 40)
+	cfg.ScenarioFile = writeTestFile(t, "scenarios.yaml", fmt.Sprintf(`scenarios:
+  - name: feed
+    weight: 3
+    method: GET
+    url: %[1]s/feed
+  - name: like
+    url: %[1]s/like
+    headers:
+      x-client: load-tester
+    body: '{"like":true}'
+`, srv.URL))
+	r := runTest(t, cfg)
+
+	feed, like := seen["GET /feed"], seen[`POST /like load-tester {"like":true}`]
+	if feed+like != 40 || feed <= like || like == 0 {
+		t.Errorf("requests %v, want 40 split about 3:1 between the feed and the like scenario", seen)
+	}
+	if len(r.Targets) != 2 || r.Targets[0].Name != "feed" || r.Targets[0].Total != uint64(feed) || r.Targets[1].Name != "like" || r.Targets[1].Total != uint64(like) {
+		t.Errorf("targets %+v, want one per scenario matching the requests sent", r.Targets)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	t.Run("abandons", func(t *testing.T) {
+		url, _ := blockingServer(t, 4)
+		cfg := testConfig(t, url, 1, 4)
+		cfg.DrainTimeout = 50 * time.Millisecond
+		start := time.Now()
+		r := runTest(t, cfg)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("the run took %s, want the last request abandoned after the drain timeout", elapsed)
+		}
+		if r.Abandoned != 1 || r.Total != 3 || r.Failure != 0 {
+			t.Errorf("%d abandoned, %d requests and %d failures, want the last request abandoned and left out of the counts", r.Abandoned, r.Total, r.Failure)
+		}
+	})
+	t.Run("completes", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+		}))
+		defer srv.Close()
+		cfg := testConfig(t, srv.URL, 2, 4)
+		cfg.DrainTimeout = 5 * time.Second
+		r := runTest(t, cfg)
+		if r.Abandoned != 0 || r.Success != 4 {
+			t.Errorf("%d abandoned and %d succeeded, want every request to complete within the drain timeout", r.Abandoned, r.Success)
+		}
+	})
+	t.Run("interrupted", func(t *testing.T) {
+		url, blocked := blockingServer(t, 2)
+		cfg := testConfig(t, url, 1, 2)
+		cfg.DrainTimeout = time.Minute
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-blocked
+			cancel()
+		}()
+		start := time.Now()
+		r, err := Run(ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("the run took %s, want an interrupt to cancel the request in flight without draining", elapsed)
+		}
+		if !r.Interrupted || r.Total != 1 || r.Abandoned != 0 {
+			t.Errorf("interrupted %t with %d requests and %d abandoned, want an interrupted run of the 1 completed request", r.Interrupted, r.Total, r.Abandoned)
+		}
+	})
+}
+
+func TestAbortErrorRate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 1, 1000)
+	cfg.AbortErrorRate, cfg.AbortWindow = 0.5, 10
+	r := runTest(t, cfg)
+	if !r.Aborted || r.Total < 10 || r.Total > 20 {
+		t.Errorf("aborted %t after %d requests, want the run aborted once the first 10 failed", r.Aborted, r.Total)
+	}
+}
+
+func TestCaptureFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Answer", "42")
+		fmt.Fprint(w, "pong")
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 1, 8)
+	cfg.CaptureFile = filepath.Join(t.TempDir(), "capture.txt")
+	cfg.CaptureSampleRate = 0.25
+	runTest(t, cfg)
+
+	data, err := os.ReadFile(cfg.CaptureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var captured []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "=== ") {
+			captured = append(captured, line[strings.Index(line, "| thread"):])
+		}
+	}
+	if want := []string{"| thread 1 | request 4 ===", "| thread 1 | request 8 ==="}; !slices.Equal(captured, want) {
+		t.Errorf("captured %q, want every fourth request", captured)
+	}
+	for _, s := range []string{"POST / HTTP/1.1", `{"id":1}`, "X-Answer: 42", "pong"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("the capture does not contain %q:\n%s", s, data)
+		}
+	}
+}
+
+func TestJSONLOutput(t *testing.T) {
+	var n atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL+"/orders", 1, 3)
+	cfg.JSONLOutput = filepath.Join(t.TempDir(), "results.jsonl")
+	cfg.MaxRetries, cfg.RetryBackoff = 1, time.Millisecond
+	runTest(t, cfg)
+
+	f, err := os.Open(cfg.JSONLOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []jsonlRecord
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var rec jsonlRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("%d records, want one per request", len(records))
+	}
+	first := records[0]
+	if first.RequestNum != 1 || first.Method != "POST" || first.URL != srv.URL+"/orders" || first.Status != 200 || !first.Success || first.Retries != 1 || first.Bytes != 2 {
+		t.Errorf("first record %+v, want request 1 succeeding with 2 bytes after 1 retry", first)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, first.Timestamp); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPayloadSequence(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 1, 7)
+	cfg.PayloadSequence = writeTestFile(t, "sequence.json", `[{"step":"create"}, "plain text", {"step":"{{.Counter}}"}]`)
+	r := runTest(t, cfg)
+
+	want := []string{`{"step":"create"}`, "plain text", `{"step":"1"}`, `{"step":"create"}`, "plain text", `{"step":"2"}`, `{"step":"create"}`}
+	if !slices.Equal(bodies, want) {
+		t.Errorf("bodies %q, want %q", bodies, want)
+	}
+	if s := r.Sequence; s == nil || *s != (SequenceReport{Length: 3, Sent: 7, Cycles: 2}) {
+		t.Errorf("sequence report %+v, want 2 cycles of 3 with 7 sent", s)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		code   int
+		header string
+		want   time.Duration
+	}{
+		{http.StatusTooManyRequests, "3", 3 * time.Second},
+		{http.StatusServiceUnavailable, " 120 ", 2 * time.Minute},
+		{http.StatusTooManyRequests, now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{http.StatusTooManyRequests, now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{http.StatusTooManyRequests, "-5", 0},
+		{http.StatusTooManyRequests, "soon", 0},
+		{http.StatusTooManyRequests, "", 0},
+		{http.StatusInternalServerError, "3", 0},
+	}
+	for _, tt := range tests {
+		res := result{code: tt.code, header: http.Header{}}
+		if tt.header != "" {
+			res.header.Set("Retry-After", tt.header)
+		}
+		if got := retryAfter(res, now); got != tt.want {
+			t.Errorf("retryAfter(%d, %q) = %s, want %s", tt.code, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestHonorRetryAfter(t *testing.T) {
+	var (
+		n    atomic.Int64
+		mu   sync.Mutex
+		sent []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		if n.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 1, 2)
+	cfg.HonorRetryAfter = true
+	r := runTest(t, cfg)
+	if len(sent) != 2 || sent[1].Sub(sent[0]) < 900*time.Millisecond {
+		t.Fatalf("requests sent at %v, want the second one a second after the 429", sent)
+	}
+	if r.RateLimited != 1 || r.RetryAfter == nil || r.RetryAfter.Waits != 1 || r.RetryAfter.WaitedMs != 1000 {
+		t.Errorf("%d rate limited and waits %+v, want one 429 and one wait of 1000ms", r.RateLimited, r.RetryAfter)
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 100))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		oversize    string
+		wantSuccess uint64
+		wantBytes   uint64
+	}{
+		{"truncate", 2, 2 * 10},
+		{"fail", 0, 2 * 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.oversize, func(t *testing.T) {
+			cfg := testConfig(t, srv.URL, 1, 2)
+			cfg.MaxResponseBytes, cfg.OversizeResponse = 10, tt.oversize
+			r := runTest(t, cfg)
+			if r.Oversized != 2 || r.Success != tt.wantSuccess || r.Bytes != tt.wantBytes {
+				t.Errorf("%d oversized, %d succeeded with %d bytes read, want 2, %d and %d", r.Oversized, r.Success, r.Bytes, tt.wantSuccess, tt.wantBytes)
+			}
+			if got := r.Failures[failureKeys[failOversized]]; got != 2-tt.wantSuccess {
+				t.Errorf("%d failures counted as oversized bodies, want %d", got, 2-tt.wantSuccess)
+			}
+		})
+	}
+}
+
+func TestHeaderPool(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.Header.Get("X-Device-Id")+" "+r.Header.Get("X-Region")]++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 2, 60)
+	cfg.Headers = map[string]string{"X-Region": "eu", "X-Device-Id": "fixed"}
+	cfg.HeaderPoolFile = writeTestFile(t, "headers.yaml", "x-device-id: [d-1, d-2, d-3]\n")
+	runTest(t, cfg)
+
+	for key, n := range seen {
+		if key != "d-1 eu" && key != "d-2 eu" && key != "d-3 eu" {
+			t.Errorf("%d requests sent with device and region %q, want a device from the pool and HEADERS otherwise", n, key)
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("devices and regions %v, want each pooled device picked", seen)
+	}
+}
+
+func TestRawRequestFile(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		seen = append(seen, fmt.Sprintf("%s %s %s %s %s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Trace"), r.Header.Get("Cookie"), body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 1, 2)
+	cfg.RawRequestFile = writeTestFile(t, "request.http", "PUT /orders/{{.Counter}}?dry=1 HTTP/1.1\r\n"+
+		"Host: shop.example.com\r\n"+
+		"X-Trace: abc\r\n"+
+		"Cookie: session=1\r\n"+
+		"Content-Length: 999\r\n"+
+		"\r\n"+
+		`{"qty":2}`+"\n")
+	runTest(t, cfg)
+
+	want := []string{`PUT /orders/1?dry=1 abc session=1 {"qty":2}`, `PUT /orders/2?dry=1 abc session=1 {"qty":2}`}
+	if !slices.Equal(seen, want) {
+		t.Errorf("requests %q, want %q", seen, want)
+	}
+}
+
+func TestAccessLogReplay(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, "", 1, 0)
+	cfg.AccessLogFile = writeTestFile(t, "access.log", `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a?x=1 HTTP/1.1" 200 10
+garbage
+{"method":"DELETE","path":"/items/7"}
+`)
+	cfg.BaseURL = srv.URL + "/v2"
+	r := runTest(t, cfg)
+
+	if want := []string{"GET /v2/a?x=1", "DELETE /v2/items/7"}; !slices.Equal(seen, want) {
+		t.Errorf("requests %q, want the log replayed once: %q", seen, want)
+	}
+	if r.Total != 2 || len(r.Targets) != 2 {
+		t.Errorf("%d requests to %d targets, want 2 requests to a target per method", r.Total, len(r.Targets))
+	}
+}
+
+func TestHMACSigning(t *testing.T) {
+	var bad atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(r.Header.Get("X-Timestamp")))
+		mac.Write(body)
+		if !hmac.Equal([]byte(r.Header.Get("X-Signature")), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+			bad.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL, 2, 6)
+	cfg.HMACSecret = "s3cret"
+	cfg.PayloadFile = writeTestFile(t, "payload.json", `{"n":{{.Counter}}}`)
+	cfg.CompressRequest = true
+	r := runTest(t, cfg)
+	if r.Success != 6 || bad.Load() != 0 {
+		t.Errorf("%d of 6 requests succeeded and %d had a bad signature, want every body as sent signed", r.Success, bad.Load())
+	}
+}
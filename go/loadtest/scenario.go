@@ -0,0 +1,125 @@
+package loadtest
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scenarioFile is the layout of SCENARIO_FILE:
+//
+//	scenarios:
+//	  - name: feed
+//	    weight: 70
+//	    method: GET
+//	    url: http://localhost:3000/feed
+//	  - name: like
+//	    weight: 30
+//	    url: http://localhost:3000/like
+//	    headers:
+//	      X-Client: load-tester
+//	    payload: like.json
+type scenarioFile struct {
+	Scenarios []scenarioSpec `yaml:"scenarios"`
+}
+
+type scenarioSpec struct {
+	Name    string            `yaml:"name"`
+	Weight  int               `yaml:"weight"` // relative share of requests, default 1
+	Method  string            `yaml:"method"` // default Config.Method
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"` // added to Config.Headers
+	Payload string            `yaml:"payload"` // body file, relative to the scenario file
+	Body    string            `yaml:"body"`    // inline body, instead of payload
+}
+
+func readScenarioFile(path string) (scenarioFile, error) {
+	var file scenarioFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("cannot parse scenario file %s: %w", path, err)
+	}
+	if len(file.Scenarios) == 0 {
+		return file, fmt.Errorf("scenario file %s defines no scenarios", path)
+	}
+	return file, nil
+}
+
+// payloadPath resolves the payload of s, relative to the scenario file path.
+func (s scenarioSpec) payloadPath(path string) string {
+	if filepath.IsAbs(s.Payload) {
+		return s.Payload
+	}
+	return filepath.Join(filepath.Dir(path), s.Payload)
+}
+
+// loadScenarios reads a scenario file into targets, one per scenario.
+// Scenarios without a payload or body send the run's default payload.
+func loadScenarios(path string) ([]*target, error) {
+	file, err := readScenarioFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]*target, 0, len(file.Scenarios))
+	for i, s := range file.Scenarios {
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("scenario %d", i+1)
+		}
+		if s.URL == "" {
+			return nil, fmt.Errorf("scenario %q has no url", s.Name)
+		}
+		if s.Weight == 0 {
+			s.Weight = 1
+		}
+		if s.Weight < 0 {
+			return nil, fmt.Errorf("scenario %q has a negative weight", s.Name)
+		}
+		s.Method = strings.ToUpper(s.Method)
+		if s.Method != "" && !validMethods[s.Method] {
+			return nil, fmt.Errorf("scenario %q: HTTP method %q is not supported", s.Name, s.Method)
+		}
+
+		t, err := newTarget(s.URL)
+		if err != nil {
+			return nil, err
+		}
+		t.name = s.Name
+		t.weight = s.Weight
+		t.method = s.Method
+		if len(s.Headers) > 0 {
+			t.headers = make(map[string]string, len(s.Headers))
+			for k, v := range s.Headers {
+				t.headers[http.CanonicalHeaderKey(k)] = v
+			}
+		}
+
+		var body []byte
+		name := s.Name
+		switch {
+		case s.Payload != "":
+			name = s.payloadPath(path)
+			if body, err = os.ReadFile(name); err != nil {
+				return nil, fmt.Errorf("scenario %q: cannot read payload: %w", s.Name, err)
+			}
+		case s.Body != "":
+			body = []byte(s.Body)
+		}
+		if body != nil {
+			p, err := newPayload(name, body)
+			if err != nil {
+				return nil, err
+			}
+			t.payloads = []payload{p}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
@@ -0,0 +1,28 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// loadSchema compiles the JSON Schema file that successful responses are
+// validated against (RESPONSE_SCHEMA).
+func loadSchema(path string) (*jsonschema.Schema, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile response schema: %w", err)
+	}
+	return schema, nil
+}
+
+// validateBody reports why body is not a JSON document matching schema, or
+// nil if it is.
+func validateBody(schema *jsonschema.Schema, body []byte) error {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	return schema.Validate(doc)
+}
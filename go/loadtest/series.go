@@ -0,0 +1,127 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// seriesPoint is one line of the TIMESERIES_FILE: the requests that
+// completed during one window and their latency percentiles.
+type seriesPoint struct {
+	Timestamp string  `json:"timestamp"` // start of the window
+	ElapsedS  float64 `json:"elapsed_s"` // seconds since the run started
+	Count     uint64  `json:"count"`
+	Failure   uint64  `json:"failure"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+}
+
+// seriesWindow accumulates the requests of the current window.
+type seriesWindow struct {
+	start   time.Time
+	count   uint64
+	failure uint64
+	hist    histogram
+}
+
+// timeSeries buckets request latencies into fixed windows and writes one
+// JSON line per window, so latency can be plotted over the course of a run.
+// Workers record into the current window without locking; a ticker swaps in
+// a fresh one at every window boundary and writes out the old one.
+type timeSeries struct {
+	closer  io.Closer // nil when writing to stdout
+	enc     *json.Encoder
+	err     error // first write error
+	started time.Time
+	current atomic.Pointer[seriesWindow]
+
+	done     chan struct{}
+	finished sync.WaitGroup
+}
+
+// newTimeSeries creates the output file, or uses stdout if path is "-".
+func newTimeSeries(path string) (*timeSeries, error) {
+	ts := &timeSeries{enc: json.NewEncoder(os.Stdout), done: make(chan struct{})}
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		ts.enc, ts.closer = json.NewEncoder(f), f
+	}
+	return ts, nil
+}
+
+// begin starts the first window at start and writes a point every interval
+// until close is called.
+func (ts *timeSeries) begin(interval time.Duration, start time.Time) {
+	ts.started = start
+	ts.current.Store(&seriesWindow{start: start})
+
+	ts.finished.Add(1)
+	go func() {
+		defer ts.finished.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				ts.flush(now)
+			case <-ts.done:
+				ts.flush(time.Now())
+				return
+			}
+		}
+	}()
+}
+
+// record adds one completed request; latency is only counted for requests
+// that received a response.
+func (ts *timeSeries) record(ns uint64, responded, ok bool) {
+	w := ts.current.Load()
+	atomic.AddUint64(&w.count, 1)
+	if !ok {
+		atomic.AddUint64(&w.failure, 1)
+	}
+	if responded {
+		w.hist.record(ns)
+	}
+}
+
+// flush starts a new window at now and writes out the one it replaces.
+// A request recorded just as the windows are swapped may land in the old
+// one after it was written; at per-second resolution that is negligible.
+func (ts *timeSeries) flush(now time.Time) {
+	w := ts.current.Swap(&seriesWindow{start: now})
+	p := w.hist.percentiles([]float64{50, 95, 99})
+	err := ts.enc.Encode(seriesPoint{
+		Timestamp: w.start.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		ElapsedS:  w.start.Sub(ts.started).Seconds(),
+		Count:     atomic.LoadUint64(&w.count),
+		Failure:   atomic.LoadUint64(&w.failure),
+		P50Ms:     float64(p[0]) / 1_000_000.0,
+		P95Ms:     float64(p[1]) / 1_000_000.0,
+		P99Ms:     float64(p[2]) / 1_000_000.0,
+	})
+	if ts.err == nil {
+		ts.err = err
+	}
+}
+
+// close writes the final, partial window and closes the file.
+func (ts *timeSeries) close() error {
+	close(ts.done)
+	ts.finished.Wait()
+	err := ts.err
+	if ts.closer != nil {
+		if cerr := ts.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package loadtest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runSetup sends the SETUP_URL request once and returns the value SETUP_EXTRACT
+// selects from its JSON response, or the whole trimmed body when no path is
+// configured. The value is then available to the load requests as {{.Setup}}.
+func runSetup(cfg Config, tlsConfig *tls.Config) (string, error) {
+	var body io.Reader
+	if cfg.SetupPayload != "" {
+		payload, err := os.ReadFile(cfg.SetupPayload)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(cfg.SetupMethod, cfg.SetupURL, body)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Transport: newTransport(cfg, tlsConfig, localAddr(cfg, 0)), Timeout: cfg.RequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if cfg.SetupExtract == "" {
+		return strings.TrimSpace(string(respBody)), nil
+	}
+	var doc any
+	if err := json.Unmarshal(respBody, &doc); err != nil {
+		return "", fmt.Errorf("response is not JSON: %w", err)
+	}
+	return extractJSON(doc, cfg.SetupExtract)
+}
+
+// extractJSON walks a dotted path such as "data.tokens[0].value" (an optional
+// leading "$." is ignored) through a decoded JSON document. Strings are
+// returned as is, any other value in its JSON encoding.
+func extractJSON(doc any, path string) (string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+
+	cur := doc
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("no field %q at %s", key, path)
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("invalid index %q at %s", key, path)
+			}
+			cur = v[i]
+		default:
+			return "", fmt.Errorf("cannot select %q from a scalar at %s", key, path)
+		}
+	}
+
+	if s, ok := cur.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(cur)
+	return string(out), err
+}
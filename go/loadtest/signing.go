@@ -0,0 +1,41 @@
+package loadtest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// hmacHashes are the accepted values of HMACAlgorithm.
+var hmacHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// signRequest signs req for HMAC_SECRET: it sets HMACTimestampHeader to the
+// Unix time of now in seconds and HMACHeader to the HMAC of that timestamp
+// followed by body, the payload exactly as sent. Each attempt is built and
+// signed afresh, so retries carry a current timestamp.
+func signRequest(cfg Config, req *http.Request, body []byte, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(hmacHashes[cfg.HMACAlgorithm], []byte(cfg.HMACSecret))
+	mac.Write([]byte(ts))
+	mac.Write(body)
+	sum := mac.Sum(nil)
+
+	sig := hex.EncodeToString(sum)
+	if cfg.HMACEncoding == "base64" {
+		sig = base64.StdEncoding.EncodeToString(sum)
+	}
+	req.Header.Set(cfg.HMACTimestampHeader, ts)
+	req.Header.Set(cfg.HMACHeader, sig)
+}
@@ -0,0 +1,35 @@
+package loadtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+	tests := []struct {
+		algorithm, encoding string
+		want                string
+	}{
+		// From printf '1700000000{"id":1}' | openssl dgst -hmac s3cret.
+		{"sha256", "hex", "5605afcb13cf7f41aba2e605d5e948ccd48b97c44d2644d4d3e709c76538dab6"},
+		{"sha1", "base64", "QvLQhONbHYoNM5lxt9j4Ngwlrdc="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm+"/"+tt.encoding, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HMACSecret, cfg.HMACAlgorithm, cfg.HMACEncoding = "s3cret", tt.algorithm, tt.encoding
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			signRequest(cfg, req, body, now)
+			if got := req.Header.Get("X-Timestamp"); got != "1700000000" {
+				t.Errorf("timestamp header %q, want 1700000000", got)
+			}
+			if got := req.Header.Get("X-Signature"); got != tt.want {
+				t.Errorf("signature %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
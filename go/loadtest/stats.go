@@ -0,0 +1,365 @@
+package loadtest
+
+import (
+	"maps"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// welford tracks the running mean and variance of a stream of samples using
+// Welford's algorithm, which stays numerically stable without buffering.
+type welford struct {
+	n    float64
+	mean float64
+	m2   float64
+}
+
+func (w *welford) add(x float64) {
+	w.n++
+	delta := x - w.mean
+	w.mean += delta / w.n
+	w.m2 += delta * (x - w.mean)
+}
+
+// merge folds o into w (Chan et al.'s parallel combination).
+func (w *welford) merge(o welford) {
+	if o.n == 0 {
+		return
+	}
+	n := w.n + o.n
+	delta := o.mean - w.mean
+	w.mean += delta * o.n / n
+	w.m2 += o.m2 + delta*delta*w.n*o.n/n
+	w.n = n
+}
+
+// stddev returns the population standard deviation of the samples.
+func (w welford) stddev() float64 {
+	if w.n == 0 {
+		return 0
+	}
+	return math.Sqrt(w.m2 / w.n)
+}
+
+// stats aggregates request outcomes across all workers of a run. All fields
+// are updated atomically so workers can record without locking.
+type stats struct {
+	success      uint64
+	failure      uint64
+	failures     [numFailureCategories]uint64
+	retries      uint64
+	warmup       uint64 // warm-up requests, excluded from every other counter
+	late         uint64 // open model arrivals that found every worker busy
+	connsNew     uint64 // requests sent on a freshly dialled connection
+	connsReused  uint64 // requests sent on a kept-alive connection
+	redirected   uint64 // requests that were redirected, followed or not
+	redirectHops uint64 // redirects followed
+	waits        uint64 // pauses for a Retry-After, see HONOR_RETRY_AFTER
+	waitedNs     uint64 // total length of those pauses
+	inflight     int64  // requests currently outstanding
+	peakInflight int64  // highest value inflight reached
+	protos       [numProtos]uint64
+
+	responses uint64 // requests that received a response
+	oversized uint64 // responses longer than MAX_RESPONSE_BYTES
+	bytesRead uint64 // response body bytes received, after decompression
+	wireBytes uint64 // response body bytes as received on the wire
+
+	// Status codes are open-ended, so they are counted in a map rather than
+	// a fixed array of atomics.
+	codesMu  sync.Mutex
+	codes    map[int]uint64
+	rpcCodes map[string]uint64 // gRPC status code names, see PROTOCOL=grpc
+
+	timed   uint64 // requests that completed a round trip, the divisor of totalNs
+	totalNs uint64
+	minNs   uint64
+	maxNs   uint64
+	hist    histogram
+	sketch  latencySketch // &hist, or a t-digest with LATENCY_ALGO=tdigest
+
+	// Each worker keeps its own welford accumulator, and with
+	// PER_THREAD_STATS its own tally, and merges them here when it exits, so
+	// the hot path never takes this lock.
+	varMu    sync.Mutex
+	variance welford
+	threads  []ThreadReport
+
+	// Requests until the first failure, see FirstFailReport: the lowest
+	// failed request number, and under varMu each worker's own count.
+	firstFailure   uint64
+	workersFailed  int
+	workerFirstMin uint64
+	workerFirstMax uint64
+
+	// Connection phase totals, each averaged over the requests that went
+	// through that phase.
+	phaseNs    [numPhases]uint64
+	phaseCount [numPhases]uint64
+
+	handshakes handshakeStats // see PROTOCOL=websocket
+
+	metrics *promMetrics // nil unless METRICS_ADDR is set
+}
+
+// Response protocol versions tracked in stats.protos.
+const (
+	protoHTTP10 = iota
+	protoHTTP11
+	protoHTTP2
+	protoOther
+	numProtos
+)
+
+var protoNames = [numProtos]string{
+	protoHTTP10: "HTTP/1.0",
+	protoHTTP11: "HTTP/1.1",
+	protoHTTP2:  "HTTP/2.0",
+	protoOther:  "other",
+}
+
+// recordProto counts the protocol version a response was received with.
+func (s *stats) recordProto(proto string) {
+	idx := protoOther
+	for i, name := range protoNames {
+		if name == proto {
+			idx = i
+			break
+		}
+	}
+	atomic.AddUint64(&s.protos[idx], 1)
+}
+
+func newStats(cfg Config, metrics *promMetrics) *stats {
+	s := &stats{
+		minNs:      ^uint64(0), // min starts at max uint64
+		codes:      make(map[int]uint64),
+		handshakes: handshakeStats{minNs: ^uint64(0)},
+		metrics:    metrics,
+	}
+	s.sketch = &s.hist
+	if cfg.LatencyAlgo == "tdigest" {
+		s.sketch = newTDigest()
+	}
+	return s
+}
+
+// recordLatency accumulates a single request duration into the running
+// total, min/max and the percentile sketch, see LATENCY_ALGO.
+func (s *stats) recordLatency(ns uint64) {
+	atomic.AddUint64(&s.timed, 1)
+	atomic.AddUint64(&s.totalNs, ns)
+	updateMin(&s.minNs, ns)
+	updateMax(&s.maxNs, ns)
+	s.sketch.record(ns)
+	if s.metrics != nil {
+		s.metrics.latency.Observe(float64(ns) / 1e9)
+	}
+}
+
+// recordResponse counts a received response by status code along with the
+// decoded and on-wire size of its body.
+func (s *stats) recordResponse(code int, bodyBytes, wireBytes int64) {
+	atomic.AddUint64(&s.responses, 1)
+	atomic.AddUint64(&s.bytesRead, uint64(bodyBytes))
+	atomic.AddUint64(&s.wireBytes, uint64(wireBytes))
+	s.codesMu.Lock()
+	s.codes[code]++
+	s.codesMu.Unlock()
+}
+
+// recordRPC counts a gRPC response by its status code name.
+func (s *stats) recordRPC(code string) {
+	s.codesMu.Lock()
+	if s.rpcCodes == nil {
+		s.rpcCodes = make(map[string]uint64)
+	}
+	s.rpcCodes[code]++
+	s.codesMu.Unlock()
+}
+
+// statusCodes returns a copy of the per-status-code response counts.
+func (s *stats) statusCodes() map[int]uint64 {
+	s.codesMu.Lock()
+	defer s.codesMu.Unlock()
+	return maps.Clone(s.codes)
+}
+
+// recordPhases accumulates the connection phases observed for one request.
+func (s *stats) recordPhases(phases [numPhases]time.Duration) {
+	for i, d := range phases {
+		if d > 0 {
+			atomic.AddUint64(&s.phaseCount[i], 1)
+			atomic.AddUint64(&s.phaseNs[i], uint64(d.Nanoseconds()))
+		}
+	}
+}
+
+// beginRequest and endRequest bracket every request sent, tracking the
+// highest number outstanding at once.
+func (s *stats) beginRequest() {
+	n := atomic.AddInt64(&s.inflight, 1)
+	for {
+		peak := atomic.LoadInt64(&s.peakInflight)
+		if n <= peak || atomic.CompareAndSwapInt64(&s.peakInflight, peak, n) {
+			return
+		}
+	}
+}
+
+func (s *stats) endRequest() {
+	atomic.AddInt64(&s.inflight, -1)
+}
+
+// recordConn counts whether a request reused a connection.
+func (s *stats) recordConn(reused bool) {
+	if reused {
+		atomic.AddUint64(&s.connsReused, 1)
+	} else {
+		atomic.AddUint64(&s.connsNew, 1)
+	}
+}
+
+// recordRedirects counts a request that followed hops redirects or, when
+// redirects are not followed, was answered with a redirect.
+func (s *stats) recordRedirects(hops, code int) {
+	if hops > 0 || isRedirect(code) {
+		atomic.AddUint64(&s.redirected, 1)
+		atomic.AddUint64(&s.redirectHops, uint64(hops))
+	}
+}
+
+// recordWait counts a pause of d asked for by a Retry-After header.
+func (s *stats) recordWait(d time.Duration) {
+	atomic.AddUint64(&s.waits, 1)
+	atomic.AddUint64(&s.waitedNs, uint64(d.Nanoseconds()))
+}
+
+// mergeVariance folds a worker's latency accumulator into the run totals.
+func (s *stats) mergeVariance(w welford) {
+	s.varMu.Lock()
+	s.variance.merge(w)
+	s.varMu.Unlock()
+}
+
+// threadStats is one worker's tally for PER_THREAD_STATS. Only that worker
+// updates it, so it needs no atomics.
+type threadStats struct {
+	success      uint64
+	failure      uint64
+	minNs        uint64
+	maxNs        uint64
+	firstFailure uint64 // requests up to and including the first that failed, 0 if none did
+}
+
+func (t *threadStats) record(ok, timed bool, ns uint64) {
+	if ok {
+		t.success++
+	} else {
+		t.failure++
+		if t.firstFailure == 0 {
+			t.firstFailure = t.success + t.failure
+		}
+	}
+	if timed {
+		if t.minNs == 0 || ns < t.minNs {
+			t.minNs = ns
+		}
+		t.maxNs = max(t.maxNs, ns)
+	}
+}
+
+// mergeThread adds the report of worker id, whose latencies w accumulated.
+func (s *stats) mergeThread(id int, t threadStats, w welford) {
+	tr := ThreadReport{Thread: id, Total: t.success + t.failure, Success: t.success, Failure: t.failure, FirstFailure: t.firstFailure}
+	if w.n > 0 {
+		tr.Latency = LatencyReport{
+			Min:    float64(t.minNs) / 1_000_000.0,
+			Avg:    w.mean / 1_000_000.0,
+			Max:    float64(t.maxNs) / 1_000_000.0,
+			StdDev: w.stddev() / 1_000_000.0,
+		}
+	}
+	s.varMu.Lock()
+	s.threads = append(s.threads, tr)
+	s.varMu.Unlock()
+}
+
+// recordFirstFailure notes that request n, numbered in the order requests
+// were handed out, failed, keeping the lowest such number.
+func (s *stats) recordFirstFailure(n uint64) {
+	for {
+		old := atomic.LoadUint64(&s.firstFailure)
+		if old != 0 && old <= n {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&s.firstFailure, old, n) {
+			return
+		}
+	}
+}
+
+// mergeFirstFailure adds a worker's count of requests up to its first
+// failure, 0 if it had none.
+func (s *stats) mergeFirstFailure(n uint64) {
+	if n == 0 {
+		return
+	}
+	s.varMu.Lock()
+	defer s.varMu.Unlock()
+	if s.workersFailed == 0 || n < s.workerFirstMin {
+		s.workerFirstMin = n
+	}
+	s.workerFirstMax = max(s.workerFirstMax, n)
+	s.workersFailed++
+}
+
+// recordSuccess counts a successful request.
+func (s *stats) recordSuccess() {
+	atomic.AddUint64(&s.success, 1)
+	if s.metrics != nil {
+		s.metrics.requests.Inc()
+		s.metrics.success.Inc()
+	}
+}
+
+// recordFailure counts a failed request both in the total and in its category.
+func (s *stats) recordFailure(c failureCategory) {
+	atomic.AddUint64(&s.failure, 1)
+	atomic.AddUint64(&s.failures[c], 1)
+	if s.metrics != nil {
+		s.metrics.requests.Inc()
+		s.metrics.failures.WithLabelValues(failureKeys[c]).Inc()
+	}
+}
+
+// completed returns the number of requests recorded so far.
+func (s *stats) completed() uint64 {
+	return atomic.LoadUint64(&s.success) + atomic.LoadUint64(&s.failure)
+}
+
+func updateMin(addr *uint64, val uint64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if val >= old {
+			return
+		}
+		if atomic.CompareAndSwapUint64(addr, old, val) {
+			return
+		}
+	}
+}
+
+func updateMax(addr *uint64, val uint64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if val <= old {
+			return
+		}
+		if atomic.CompareAndSwapUint64(addr, old, val) {
+			return
+		}
+	}
+}
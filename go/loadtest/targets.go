@@ -0,0 +1,166 @@
+package loadtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+)
+
+// target is a single endpoint under test along with its own result counters.
+// Counters are updated atomically by the workers. Targets loaded from a
+// SCENARIO_FILE also carry their own request settings.
+type target struct {
+	url      string
+	tmpl     *template.Template // nil unless url contains template placeholders
+	name     string             // scenario name, empty for plain URLs
+	weight   int                // scenario weight, 0 for plain URLs
+	method   string             // empty uses Config.Method
+	headers  map[string]string  // added to Config.Headers
+	payloads []payload          // nil uses the run's payloads
+
+	success uint64
+	failure uint64
+	timed   uint64 // requests that completed a round trip and have a latency
+	totalNs uint64
+	minNs   uint64
+	maxNs   uint64
+}
+
+// targetSet is the list of targets for a run and the shared round-robin
+// cursor. Weighted scenarios are picked at random instead.
+type targetSet struct {
+	list        []*target
+	cursor      uint64
+	cumWeights  []int // running totals of the scenario weights, nil for round-robin
+	totalWeight int
+}
+
+// loadTargetURLs returns the list of URLs to test: list (TARGET_URLS,
+// comma-separated) if set, otherwise the lines of urls.txt if present,
+// otherwise the single fallback (TARGET_URL).
+func loadTargetURLs(list, fallback string) ([]string, error) {
+	if list != "" {
+		var urls []string
+		for _, u := range strings.Split(list, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		return urls, nil
+	}
+
+	f, err := os.Open("urls.txt")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: cannot read urls.txt: %v", err)
+		}
+		return []string{fallback}, nil
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read urls.txt: %w", err)
+	}
+	if len(urls) == 0 {
+		return []string{fallback}, nil
+	}
+	return urls, nil
+}
+
+func newTarget(u string) (*target, error) {
+	tmpl, err := parseTemplate(u, u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL template %q: %w", u, err)
+	}
+	return &target{url: u, tmpl: tmpl, minNs: ^uint64(0)}, nil
+}
+
+func newTargetSet(urls []string) (*targetSet, error) {
+	ts := &targetSet{list: make([]*target, len(urls))}
+	for i, u := range urls {
+		t, err := newTarget(u)
+		if err != nil {
+			return nil, err
+		}
+		ts.list[i] = t
+	}
+	return ts, nil
+}
+
+// newScenarioSet builds a weighted target set from scenario targets.
+func newScenarioSet(targets []*target) *targetSet {
+	ts := &targetSet{list: targets, cumWeights: make([]int, len(targets))}
+	for i, t := range targets {
+		ts.totalWeight += t.weight
+		ts.cumWeights[i] = ts.totalWeight
+	}
+	return ts
+}
+
+// requestMethod returns the HTTP method requests to t are sent with.
+func (t *target) requestMethod(cfg Config) string {
+	if t.method != "" {
+		return t.method
+	}
+	return cfg.Method
+}
+
+// render returns the URL for one request, executing the template if there is one.
+func (t *target) render(vars templateVars) string {
+	if t.tmpl == nil {
+		return t.url
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, vars); err != nil {
+		// parseTemplate already did a trial run, so this should not happen.
+		log.Printf("Warning: cannot render URL template %q: %v", t.url, err)
+		return t.url
+	}
+	return b.String()
+}
+
+// next picks the target for the next request: by weight using the worker's
+// rng for scenarios, otherwise round-robin across all workers.
+func (ts *targetSet) next(rng *rand.Rand) *target {
+	if len(ts.list) == 1 {
+		return ts.list[0]
+	}
+	if ts.cumWeights != nil {
+		i, _ := slices.BinarySearch(ts.cumWeights, rng.Intn(ts.totalWeight)+1)
+		return ts.list[i]
+	}
+	n := atomic.AddUint64(&ts.cursor, 1) - 1
+	return ts.list[n%uint64(len(ts.list))]
+}
+
+func (t *target) recordLatency(ns uint64) {
+	atomic.AddUint64(&t.timed, 1)
+	atomic.AddUint64(&t.totalNs, ns)
+	updateMin(&t.minNs, ns)
+	updateMax(&t.maxNs, ns)
+}
+
+func (t *target) recordResult(ok bool) {
+	if ok {
+		atomic.AddUint64(&t.success, 1)
+	} else {
+		atomic.AddUint64(&t.failure, 1)
+	}
+}
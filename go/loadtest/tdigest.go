@@ -0,0 +1,214 @@
+package loadtest
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+)
+
+// latencySketch is where recordLatency counts latencies and percentiles are
+// read from: the histogram for LATENCY_ALGO=exact, or a t-digest for
+// LATENCY_ALGO=tdigest.
+type latencySketch interface {
+	record(ns uint64)
+	percentiles(ps []float64) []uint64
+	distribution(bounds []uint64) []uint64
+}
+
+// tdigestCompression bounds the number of centroids of a t-digest to a small
+// multiple of its value, however many latencies it holds.
+const tdigestCompression = 200
+
+// tdigestBuffer is how many latencies are collected before they are merged
+// into the centroids.
+const tdigestBuffer = 5 * tdigestCompression
+
+// centroid is a cluster of latencies of a t-digest: their mean in
+// nanoseconds and how many there are.
+type centroid struct {
+	Mean  float64 `json:"mean"`
+	Count float64 `json:"count"`
+}
+
+// tdigestState is a t-digest as agents ship it to the coordinator.
+type tdigestState struct {
+	Centroids []centroid `json:"centroids"`
+	Min       float64    `json:"min"`
+	Max       float64    `json:"max"`
+}
+
+// tdigest is a merging t-digest (Dunning and Ertl, "Computing Extremely
+// Accurate Quantiles Using t-Digests"): latencies are clustered into
+// centroids that are smallest near the tails, so memory stays constant
+// while the high percentiles stay accurate. Unlike the histogram it takes a
+// lock for every latency.
+type tdigest struct {
+	mu        sync.Mutex
+	centroids []centroid // merged, by ascending mean
+	buffer    []centroid // not merged yet
+	total     float64    // count of the merged centroids
+	min, max  float64
+}
+
+func newTDigest() *tdigest {
+	return &tdigest{min: math.Inf(1), max: math.Inf(-1)}
+}
+
+func (d *tdigest) record(ns uint64) {
+	v := float64(ns)
+	d.mu.Lock()
+	d.buffer = append(d.buffer, centroid{Mean: v, Count: 1})
+	d.min, d.max = min(d.min, v), max(d.max, v)
+	if len(d.buffer) >= tdigestBuffer {
+		d.compress()
+	}
+	d.mu.Unlock()
+}
+
+// scale is the k2 scale function for total latencies, which limits each
+// centroid to a share of the quantile range proportional to q(1-q), so
+// that the tails are kept at a much finer grain than the median. It is
+// infinite at 0 and 1, which keeps the extremes as single latencies.
+func (d *tdigest) scale(q, total float64) float64 {
+	z := 4*math.Log(max(total/tdigestCompression, 1)) + 24
+	q = min(max(q, 0), 1)
+	return tdigestCompression / z * math.Log(q/(1-q))
+}
+
+// compress merges the buffer into the centroids. The caller holds mu.
+func (d *tdigest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(d.centroids)+len(d.buffer))
+	all = append(append(all, d.centroids...), d.buffer...)
+	slices.SortFunc(all, func(a, b centroid) int { return cmp.Compare(a.Mean, b.Mean) })
+	total := d.total
+	for _, c := range d.buffer {
+		total += c.Count
+	}
+
+	merged := all[:1]
+	cur := &merged[0]
+	seen := 0.0 // count before cur
+	kLeft := d.scale(0, total)
+	for _, c := range all[1:] {
+		if d.scale((seen+cur.Count+c.Count)/total, total)-kLeft <= 1 {
+			cur.Count += c.Count
+			cur.Mean += (c.Mean - cur.Mean) * c.Count / cur.Count
+			continue
+		}
+		seen += cur.Count
+		kLeft = d.scale(seen/total, total)
+		merged = append(merged, c)
+		cur = &merged[len(merged)-1]
+	}
+	d.centroids, d.buffer, d.total = slices.Clip(merged), d.buffer[:0], total
+}
+
+// quantile interpolates the latency at rank between the centroid means, with
+// each centroid's count centered on its mean, and the recorded min and max
+// at either end. The caller holds mu and has compressed the digest.
+func (d *tdigest) quantile(rank float64) float64 {
+	cs := d.centroids
+	first, last := cs[0], cs[len(cs)-1]
+	if rank <= first.Count/2 {
+		return d.min + (first.Mean-d.min)*rank/(first.Count/2)
+	}
+	seen := 0.0
+	for i := 0; i < len(cs)-1; i++ {
+		left := seen + cs[i].Count/2
+		right := seen + cs[i].Count + cs[i+1].Count/2
+		if rank <= right {
+			return cs[i].Mean + (cs[i+1].Mean-cs[i].Mean)*(rank-left)/(right-left)
+		}
+		seen += cs[i].Count
+	}
+	left := d.total - last.Count/2
+	return last.Mean + (d.max-last.Mean)*(rank-left)/(last.Count/2)
+}
+
+// rank is the inverse of quantile: how many latencies are at most v.
+func (d *tdigest) rank(v float64) float64 {
+	cs := d.centroids
+	first, last := cs[0], cs[len(cs)-1]
+	switch {
+	case v < d.min:
+		return 0
+	case v >= d.max:
+		return d.total
+	case v < first.Mean:
+		return first.Count / 2 * (v - d.min) / (first.Mean - d.min)
+	}
+	seen := 0.0
+	for i := 0; i < len(cs)-1; i++ {
+		if v < cs[i+1].Mean {
+			left := seen + cs[i].Count/2
+			right := seen + cs[i].Count + cs[i+1].Count/2
+			return left + (right-left)*(v-cs[i].Mean)/(cs[i+1].Mean-cs[i].Mean)
+		}
+		seen += cs[i].Count
+	}
+	left := d.total - last.Count/2
+	return left + last.Count/2*(v-last.Mean)/(d.max-last.Mean)
+}
+
+// percentiles returns the latency in nanoseconds at each of the given
+// percentiles (0-100). All results are zero if nothing was recorded.
+func (d *tdigest) percentiles(ps []float64) []uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.compress()
+	out := make([]uint64, len(ps))
+	if d.total == 0 {
+		return out
+	}
+	for i, p := range ps {
+		v := d.quantile(p / 100 * d.total)
+		out[i] = uint64(math.Round(min(max(v, d.min), d.max)))
+	}
+	return out
+}
+
+// distribution estimates, like histogram.distribution, how many latencies
+// fall below each of the ascending bounds (in nanoseconds) and above the
+// previous one, plus those at or above the last bound.
+func (d *tdigest) distribution(bounds []uint64) []uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.compress()
+	out := make([]uint64, len(bounds)+1)
+	if d.total == 0 {
+		return out
+	}
+	var below uint64
+	for i, b := range bounds {
+		// Latencies are whole nanoseconds, so those below b are at most b-1.
+		n := uint64(math.Round(d.rank(float64(b) - 1)))
+		out[i] = n - below
+		below = n
+	}
+	out[len(bounds)] = uint64(math.Round(d.total)) - below
+	return out
+}
+
+// state returns the centroids, merged, for shipping to the coordinator.
+func (d *tdigest) state() tdigestState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.compress()
+	return tdigestState{Centroids: slices.Clone(d.centroids), Min: d.min, Max: d.max}
+}
+
+// add merges an agent's state into d.
+func (d *tdigest) add(s tdigestState) {
+	if len(s.Centroids) == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.buffer = append(d.buffer, s.Centroids...)
+	d.min, d.max = min(d.min, s.Min), max(d.max, s.Max)
+	d.compress()
+	d.mu.Unlock()
+}
@@ -0,0 +1,127 @@
+package loadtest
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// checkRankError fails unless each estimate of percentile ps[i] of the
+// sorted values is at the right rank: a t-digest bounds the error in rank,
+// not in value, which may be far off where there is a gap between values.
+// The tolerance tightens towards the tails, and the minimum and maximum
+// are exact.
+func checkRankError(t *testing.T, sorted []uint64, ps []float64, got []uint64) {
+	t.Helper()
+	n := float64(len(sorted))
+	for i, v := range got {
+		q := ps[i] / 100
+		switch q {
+		case 0, 1:
+			if want := exactPercentile(sorted, ps[i]); v != want {
+				t.Errorf("p%g = %d, want exactly %d", ps[i], v, want)
+			}
+			continue
+		}
+		// Any rank among the latencies equal to v is right.
+		lo := float64(sort.Search(len(sorted), func(j int) bool { return sorted[j] >= v })) / n
+		hi := float64(sort.Search(len(sorted), func(j int) bool { return sorted[j] > v })) / n
+		off := max(lo-q, q-hi, 0)
+		if tol := min(0.005, (1-q)/4); off > tol {
+			t.Errorf("p%g = %d, which is at rank %.5f-%.5f (off by %.5f, want at most %.5f)", ps[i], v, lo, hi, off, tol)
+		}
+	}
+}
+
+func TestTDigestPercentiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		gen  func() uint64
+	}{
+		{"constant", func() uint64 { return 5_000_000 }},
+		{"uniform 1-100ms", func() uint64 { return uint64(1_000_000 + rng.Int63n(99_000_000)) }},
+		{"long tail", func() uint64 { return uint64(math.Exp(rng.NormFloat64()*1.5 + 15)) }},
+		{"two modes", func() uint64 {
+			if rng.Intn(10) == 0 {
+				return uint64(200_000_000 + rng.Int63n(10_000_000))
+			}
+			return uint64(2_000_000 + rng.Int63n(1_000_000))
+		}},
+	}
+	ps := []float64{0, 1, 50, 90, 99, 99.9, 99.99, 100}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTDigest()
+			values := make([]uint64, 50_000)
+			for i := range values {
+				values[i] = tt.gen()
+				d.record(values[i])
+			}
+			slices.Sort(values)
+			checkRankError(t, values, ps, d.percentiles(ps))
+			if n := len(d.centroids); n > 2*tdigestCompression {
+				t.Errorf("%d centroids for %d latencies, want at most %d", n, len(values), 2*tdigestCompression)
+			}
+		})
+	}
+}
+
+func TestTDigestEmpty(t *testing.T) {
+	d := newTDigest()
+	for i, v := range d.percentiles([]float64{50, 99}) {
+		if v != 0 {
+			t.Errorf("percentile %d of an empty digest = %d, want 0", i, v)
+		}
+	}
+	if got := d.distribution([]uint64{1_000_000}); !slices.Equal(got, []uint64{0, 0}) {
+		t.Errorf("distribution of an empty digest = %v, want [0 0]", got)
+	}
+}
+
+func TestTDigestDistribution(t *testing.T) {
+	d := newTDigest()
+	var h histogram
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 20_000; i++ {
+		ns := uint64(1_000_000 + rng.Int63n(99_000_000))
+		d.record(ns)
+		h.record(ns)
+	}
+	bounds := []uint64{10_000_000, 50_000_000, 90_000_000}
+	got, want := d.distribution(bounds), h.distribution(bounds)
+	var total uint64
+	for i := range got {
+		total += got[i]
+		if diff := math.Abs(float64(got[i]) - float64(want[i])); diff > 0.01*20_000 {
+			t.Errorf("bucket %d = %d, want about %d", i, got[i], want[i])
+		}
+	}
+	if total != 20_000 {
+		t.Errorf("buckets add up to %d, want 20000", total)
+	}
+}
+
+func TestTDigestAdd(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	parts := []*tdigest{newTDigest(), newTDigest(), newTDigest()}
+	values := make([]uint64, 30_000)
+	for i := range values {
+		values[i] = uint64(math.Exp(rng.NormFloat64() + 16))
+		parts[i%len(parts)].record(values[i])
+	}
+	merged := newTDigest()
+	for _, p := range parts {
+		merged.add(p.state())
+	}
+	merged.add(tdigestState{}) // an agent that timed nothing
+	slices.Sort(values)
+
+	ps := []float64{0, 50, 95, 99, 99.9, 100}
+	checkRankError(t, values, ps, merged.percentiles(ps))
+	if merged.total != float64(len(values)) {
+		t.Errorf("merged digest counts %g latencies, want %d", merged.total, len(values))
+	}
+}
@@ -0,0 +1,82 @@
+package loadtest
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// templateVars is the data URL and payload templates are executed with. Each
+// placeholder is a method, so only the ones a template actually uses are
+// evaluated.
+type templateVars struct {
+	rng     *rand.Rand
+	counter *uint64
+	setup   string // value extracted by the setup request
+}
+
+// RandomInt returns a non-negative pseudo-random 31-bit integer.
+func (v templateVars) RandomInt() int32 { return v.rng.Int31() }
+
+// RandomIntn returns a pseudo-random integer in [0, n).
+func (v templateVars) RandomIntn(n int) int { return v.rng.Intn(n) }
+
+// UUID returns a random version 4 UUID.
+func (v templateVars) UUID() string {
+	var b [16]byte
+	v.rng.Read(b[:])
+	return formatUUID(b)
+}
+
+// uniqueUUID returns a version 4 UUID from the system's secure random
+// source. Unlike {{.UUID}} it does not follow SEED, so a replayed run does
+// not repeat it.
+func uniqueUUID() string {
+	var b [16]byte
+	crand.Read(b[:])
+	return formatUUID(b)
+}
+
+// formatUUID sets the version and variant bits of b and formats it as a UUID.
+func formatUUID(b [16]byte) string {
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Timestamp returns the current time in RFC 3339 format with millisecond precision.
+func (v templateVars) Timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// UnixMilli returns the current time as milliseconds since the Unix epoch.
+func (v templateVars) UnixMilli() int64 { return time.Now().UnixMilli() }
+
+// Counter returns the next value of a counter shared by all workers, starting at 1.
+func (v templateVars) Counter() uint64 { return atomic.AddUint64(v.counter, 1) }
+
+// Setup returns the value extracted from the SETUP_URL response.
+func (v templateVars) Setup() string { return v.setup }
+
+// parseTemplate compiles s if it contains template actions. It returns nil
+// for plain strings so callers can skip rendering altogether.
+func parseTemplate(name, s string) (*template.Template, error) {
+	if !strings.Contains(s, "{{") {
+		return nil, nil
+	}
+	t, err := template.New(name).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown placeholders only surface on execution, so do a trial run
+	// against throwaway state to catch them at startup.
+	var counter uint64
+	if err := t.Execute(&strings.Builder{}, templateVars{rng: rand.New(rand.NewSource(0)), counter: &counter}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
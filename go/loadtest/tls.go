@@ -0,0 +1,43 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// newTLSConfig builds the TLS settings shared by every connection of a run:
+// the client certificate of ClientCert and ClientKey for mutual TLS, the
+// extra root of CACert and InsecureSkipVerify. It returns nil if none of
+// them is set, leaving the transport's defaults alone. Files are read once,
+// here, rather than by every worker.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.ClientCert == "" && cfg.CACert == "" && !cfg.InsecureSkipVerify {
+		return nil, nil
+	}
+	conf := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate: %w", err)
+		}
+		// The system roots stay trusted, so the CA only adds to them.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", cfg.CACert)
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
+}
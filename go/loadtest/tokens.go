@@ -0,0 +1,82 @@
+package loadtest
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// authToken is one bearer token from AUTH_TOKENS_FILE and the outcome of the
+// requests sent with it. Counters are updated atomically by the workers.
+type authToken struct {
+	value     string
+	success   uint64
+	failure   uint64
+	throttled uint64 // failures that were 429 Too Many Requests
+}
+
+// tokenPool hands out the tokens of AUTH_TOKENS_FILE, one per request, either
+// round-robin through a shared cursor or at random.
+type tokenPool struct {
+	list   []*authToken
+	cursor uint64
+	random bool
+}
+
+// loadTokens reads one token per line from path, skipping blank lines and
+// lines starting with #.
+func loadTokens(path string, random bool) (*tokenPool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read AUTH_TOKENS_FILE: %w", err)
+	}
+	defer f.Close()
+
+	pool := &tokenPool{random: random}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pool.list = append(pool.list, &authToken{value: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read AUTH_TOKENS_FILE: %w", err)
+	}
+	if len(pool.list) == 0 {
+		return nil, fmt.Errorf("AUTH_TOKENS_FILE %s contains no tokens", path)
+	}
+	return pool, nil
+}
+
+// next picks the token for the next request.
+func (p *tokenPool) next(rng *rand.Rand) *authToken {
+	if p.random {
+		return p.list[rng.Intn(len(p.list))]
+	}
+	n := atomic.AddUint64(&p.cursor, 1) - 1
+	return p.list[n%uint64(len(p.list))]
+}
+
+func (t *authToken) recordResult(ok bool, code int) {
+	switch {
+	case ok:
+		atomic.AddUint64(&t.success, 1)
+	case code == http.StatusTooManyRequests:
+		atomic.AddUint64(&t.throttled, 1)
+		fallthrough
+	default:
+		atomic.AddUint64(&t.failure, 1)
+	}
+}
+
+// tokenLabel identifies token i (0-based) in reports by its position in the
+// file alone, as even part of a token narrows down guessing the rest.
+func tokenLabel(i int) string {
+	return fmt.Sprintf("#%d", i+1)
+}
@@ -0,0 +1,14 @@
+package loadtest
+
+import (
+	"testing"
+)
+
+func TestTokenLabel(t *testing.T) {
+	if got := tokenLabel(0); got != "#1" {
+		t.Errorf("tokenLabel(0) = %q, want #1", got)
+	}
+	if got := tokenLabel(41); got != "#42" {
+		t.Errorf("tokenLabel(41) = %q, want #42", got)
+	}
+}
@@ -0,0 +1,87 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Connection phases timed with TRACE_TIMING.
+const (
+	phaseDNS = iota
+	phaseConnect
+	phaseTLS
+	phaseTTFB
+	numPhases
+)
+
+var phaseNames = [numPhases]string{
+	phaseDNS:     "dns",
+	phaseConnect: "connect",
+	phaseTLS:     "tls",
+	phaseTTFB:    "ttfb",
+}
+
+// requestTrace records whether a request got a new or a reused connection
+// and, with TRACE_TIMING, its phase durations. DNS, connect and TLS only
+// happen on new connections, so reused ones leave them at zero.
+type requestTrace struct {
+	mu      sync.Mutex // dial attempts may race, e.g. for IPv4 and IPv6
+	start   time.Time
+	marks   [numPhases]time.Time
+	phases  [numPhases]time.Duration
+	gotConn bool
+	reused  bool
+}
+
+func (t *requestTrace) begin(phase int) {
+	t.mu.Lock()
+	if t.marks[phase].IsZero() {
+		t.marks[phase] = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+func (t *requestTrace) end(phase int) {
+	t.mu.Lock()
+	if !t.marks[phase].IsZero() {
+		t.phases[phase] = time.Since(t.marks[phase])
+	}
+	t.mu.Unlock()
+}
+
+// clientTrace returns the hooks to install on the request; the phase hooks
+// are left out unless timing is set.
+func (t *requestTrace) clientTrace(timing bool) *httptrace.ClientTrace {
+	gotConn := func(info httptrace.GotConnInfo) {
+		t.mu.Lock()
+		t.gotConn, t.reused = true, info.Reused
+		t.mu.Unlock()
+	}
+	if !timing {
+		return &httptrace.ClientTrace{GotConn: gotConn}
+	}
+	return &httptrace.ClientTrace{
+		GotConn:           gotConn,
+		DNSStart:          func(httptrace.DNSStartInfo) { t.begin(phaseDNS) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.end(phaseDNS) },
+		ConnectStart:      func(string, string) { t.begin(phaseConnect) },
+		ConnectDone:       func(string, string, error) { t.end(phaseConnect) },
+		TLSHandshakeStart: func() { t.begin(phaseTLS) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.end(phaseTLS) },
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.phases[phaseTTFB] = time.Since(t.start)
+			t.mu.Unlock()
+		},
+	}
+}
+
+// result returns the observed phase durations, zero for phases that did not
+// happen, and whether a connection was obtained and if it was reused.
+func (t *requestTrace) result() (phases [numPhases]time.Duration, gotConn, reused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phases, t.gotConn, t.reused
+}
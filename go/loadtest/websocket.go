@@ -0,0 +1,202 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// wsSession is a worker's connection to a PROTOCOL=websocket target. It is
+// opened by the first message and opened again after a message fails or
+// once it has carried WS_MESSAGES_PER_CONNECTION messages.
+type wsSession struct {
+	dialer *websocket.Dialer
+	conn   *websocket.Conn
+	sent   int // messages sent on conn
+}
+
+// newWSSession prepares a session that dials like the HTTP transport does,
+// honoring PROXY_URL, RESOLVE, UNIX_SOCKET and the local address.
+func newWSSession(cfg Config, tlsConf *tls.Config, local net.Addr) *wsSession {
+	t := newTransport(cfg, tlsConf, local)
+	return &wsSession{dialer: &websocket.Dialer{
+		NetDialContext:   t.DialContext,
+		Proxy:            t.Proxy,
+		TLSClientConfig:  tlsConf,
+		HandshakeTimeout: cfg.DialTimeout + cfg.TLSHandshakeTimeout,
+	}}
+}
+
+// close ends the current connection, if any, with a normal closure.
+func (s *wsSession) close() {
+	if s.conn == nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	s.drop()
+}
+
+// drop abandons the current connection after an error, so the next message
+// opens a new one rather than reading a late reply to this one.
+func (s *wsSession) drop() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.sent = nil, 0
+	}
+}
+
+// exchange sends payload as one message, text unless it is not valid UTF-8,
+// and waits for the next message from the server, as an echo or
+// request-response server sends. Its latency is that round trip; opening
+// the connection first is timed separately in the result. The reply must
+// contain EXPECT_BODY_CONTAINS and match schema, if set.
+func (s *wsSession) exchange(ctx context.Context, cfg Config, tgt *target, url string, payload []byte, token string, pooled http.Header, schema *jsonschema.Schema) result {
+	var res result
+	if s.conn == nil {
+		req, err := newRequest(cfg, tgt, url, nil, token, "", pooled)
+		if err != nil {
+			return result{failure: failOther, err: err, errMsg: "build error", start: time.Now()}
+		}
+		for _, k := range []string{"Connection", "Upgrade"} {
+			req.Header.Del(k) // set by the dialer, which rejects duplicates
+		}
+		dctx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.RequestTimeout > 0 {
+			dctx, cancel = context.WithTimeout(ctx, cfg.RequestTimeout)
+		}
+		start := time.Now()
+		conn, resp, err := s.dialer.DialContext(dctx, url, req.Header)
+		handshake := time.Since(start)
+		cancel()
+		res.dialed = true
+		if err != nil {
+			if resp != nil {
+				// Refused with an HTTP response, e.g. 503 at a connection limit.
+				resp.Body.Close()
+				res.status, res.code, res.proto = resp.Status, resp.StatusCode, resp.Proto
+				res.start, res.latency = start, handshake
+				res.failure = classifyStatus(resp.StatusCode) // even a 200 is a refusal here
+				res.errMsg = fmt.Sprintf("handshake refused (%s)", resp.Status)
+				return res
+			}
+			res.failure, res.err, res.errMsg, res.start = classifyError(err), err, "handshake error", start
+			return res
+		}
+		s.conn = conn
+		res.handshake = handshake
+	} else {
+		res.reused = true
+	}
+	res.gotConn = true
+
+	// Requests outlive the run until DRAIN_TIMEOUT cancels ctx, which must
+	// also cut short a read that is still waiting.
+	conn := s.conn
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	var deadline time.Time
+	if cfg.RequestTimeout > 0 {
+		deadline = time.Now().Add(cfg.RequestTimeout)
+	}
+	conn.SetWriteDeadline(deadline)
+	conn.SetReadDeadline(deadline)
+
+	kind := websocket.TextMessage
+	if !utf8.Valid(payload) {
+		kind = websocket.BinaryMessage
+	}
+	res.start = time.Now()
+	if err := conn.WriteMessage(kind, payload); err != nil {
+		s.drop()
+		res.failure, res.err, res.errMsg = classifyError(err), err, "send error"
+		return res
+	}
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		s.drop()
+		var closeErr *websocket.CloseError
+		switch {
+		case errors.As(err, &closeErr):
+			res.failure, res.err, res.errMsg = failConnect, err, fmt.Sprintf("closed by server (%d)", closeErr.Code)
+		case isTimeout(err):
+			res.failure, res.err, res.errMsg = failTimeout, err, fmt.Sprintf("timeout after %s", cfg.RequestTimeout)
+		default:
+			res.failure, res.err, res.errMsg = classifyError(err), err, "receive error"
+		}
+		return res
+	}
+	res.latency = time.Since(res.start)
+	if s.sent++; cfg.WSMessagesPerConn > 0 && s.sent >= cfg.WSMessagesPerConn {
+		s.close()
+	}
+
+	res.status, res.code, res.proto = "WebSocket reply", http.StatusSwitchingProtocols, "HTTP/1.1"
+	res.bytes, res.wire = int64(len(reply)), int64(len(reply))
+	switch {
+	case cfg.ExpectBodyContains != "" && !strings.Contains(string(reply), cfg.ExpectBodyContains):
+		res.failure = failBodyMismatch
+	case schema != nil:
+		if err := validateBody(schema, reply); err != nil {
+			res.failure, res.err = failSchemaViolation, err
+			res.errMsg = "schema violation (WebSocket reply)"
+			break
+		}
+		res.ok = true
+	default:
+		res.ok = true
+	}
+	return res
+}
+
+// handshakeStats times the WebSocket handshakes of a run, see
+// PROTOCOL=websocket. Like stats, it is updated atomically, and minNs
+// starts at the maximum value.
+type handshakeStats struct {
+	opened  uint64
+	failed  uint64
+	totalNs uint64
+	minNs   uint64
+	maxNs   uint64
+	hist    histogram
+}
+
+// record counts one handshake that took d, or failed if d is 0.
+func (h *handshakeStats) record(d time.Duration) {
+	if d <= 0 {
+		atomic.AddUint64(&h.failed, 1)
+		return
+	}
+	ns := uint64(d.Nanoseconds())
+	atomic.AddUint64(&h.opened, 1)
+	atomic.AddUint64(&h.totalNs, ns)
+	updateMin(&h.minNs, ns)
+	updateMax(&h.maxNs, ns)
+	h.hist.record(ns)
+}
+
+// report summarizes the handshakes, with percentiles at ps.
+func (h *handshakeStats) report(ps []float64) *HandshakeReport {
+	r := &HandshakeReport{
+		Opened: atomic.LoadUint64(&h.opened),
+		Failed: atomic.LoadUint64(&h.failed),
+		hist:   &h.hist,
+	}
+	if r.Opened > 0 {
+		r.Latency.Min = float64(atomic.LoadUint64(&h.minNs)) / 1_000_000.0
+		r.Latency.Avg = float64(atomic.LoadUint64(&h.totalNs)) / float64(r.Opened) / 1_000_000.0
+		r.Latency.Max = float64(atomic.LoadUint64(&h.maxNs)) / 1_000_000.0
+	}
+	r.Latency.Percentiles = latencyPercentiles(ps, r.hist)
+	return r
+}
@@ -1,199 +1,123 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
 	"runtime"
-	"strconv"
-	"sync"
-	"sync/atomic"
-	"time"
+	"syscall"
 
-	"github.com/joho/godotenv"
+	"loadtester_go/loadtest"
 )
 
-var (
-	totalDurationNs   uint64
-	minDurationNs     uint64 = ^uint64(0) // initialize to max uint64
-	maxDurationNs     uint64
-	successCount      uint64
-	failureCount      uint64
-	numThreads        int
-	requestsPerThread int
-	targetURL         string
-	authToken         string
-)
+func main() {
+	cfg := parseConfig(os.Args[1:])
+	if cfg.LogFormat == "json" {
+		// Routes the standard logger through slog too, so that every line,
+		// not just the per-request records, is a JSON object.
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
 
-func getenvInt(key string, def int) int {
-	if v, ok := os.LookupEnv(key); ok {
-		if parsed, err := strconv.Atoi(v); err == nil {
-			return parsed
+	if cfg.DryRun {
+		if err := loadtest.DryRun(cfg, os.Stdout); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
 		}
-		log.Printf("Warning: could not parse env var %s as int: %s. Using default %d", key, v, def)
+		return
 	}
-	return def
-}
 
-func getenvStr(key, def string) string {
-	if v, ok := os.LookupEnv(key); ok && v != "" {
-		return v
-	}
-	if def == "" && key != "AUTH_TOKEN" { // Auth token can be empty for some tests
-		log.Printf("Warning: env var %s is not set and no default value provided", key)
+	// Without MAX_PROCS the runtime default applies, which honours the
+	// GOMAXPROCS environment variable.
+	if cfg.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.MaxProcs)
 	}
-	return def
-}
 
-func init() {
-	// load .env if present, ignore error if missing
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("No .env file found, using defaults or environment variables")
+	// SIGINT/SIGTERM cancel the requests in flight; the report then covers the
+	// requests that completed and is marked as interrupted.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Printf("Received %s, cancelling the requests in flight...", sig)
+		cancel()
+	}()
+
+	if cfg.Mode == "agent" {
+		log.Printf("🛰  Agent listening on %s, waiting for a coordinator...", cfg.AgentAddr)
+		if err := loadtest.ServeAgent(ctx, cfg.AgentAddr, cfg.AgentToken); err != nil {
+			log.Fatalf("Agent stopped: %v", err)
+		}
+		return
 	}
 
-	numThreads = getenvInt("NUM_THREADS", 20)
-	requestsPerThread = getenvInt("REQUESTS_PER_THREAD", 50)
-	targetURL = getenvStr("TARGET_URL", "http://localhost:3000/api/foo")
-	authToken = getenvStr("AUTH_TOKEN", "") // Default to empty, can be set in .env or actual env
-
-	if targetURL == "" {
-		log.Fatal("TARGET_URL must be set either in .env or as an environment variable")
+	if cfg.TargetURLA != "" {
+		runAB(ctx, cfg)
+		return
 	}
-}
 
-func updateMin(val uint64) {
-	for {
-		old := atomic.LoadUint64(&minDurationNs)
-		if val >= old {
-			return
-		}
-		if atomic.CompareAndSwapUint64(&minDurationNs, old, val) {
-			return
-		}
+	run := loadtest.Run
+	if cfg.Mode == "coordinator" {
+		run = loadtest.RunDistributed
 	}
-}
-
-func updateMax(val uint64) {
-	for {
-		old := atomic.LoadUint64(&maxDurationNs)
-		if val <= old {
-			return
-		}
-		if atomic.CompareAndSwapUint64(&maxDurationNs, old, val) {
-			return
-		}
+	report, err := run(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Cannot start load test: %v", err)
 	}
-}
-
-func worker(threadID int, payload []byte, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	client := &http.Client{
-		Transport: &http.Transport{DisableKeepAlives: true},
-		Timeout:   0, // No timeout for individual requests, overall controlled by context if needed
+	// In machine mode the JSON report is the summary, so the text one is
+	// left out along with the decoration.
+	if !cfg.NoBanner || cfg.OutputFormat != "json" {
+		loadtest.LogReport(cfg, report)
+	}
+	passed := loadtest.ThresholdsPassed(cfg, report)
+	if err := loadtest.PushMetrics(cfg, report); err != nil {
+		log.Printf("Warning: could not push metrics: %v", err)
 	}
 
-	for i := range requestsPerThread {
-		reqNum := i + 1
-
-		req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(payload))
-		if err != nil {
-			log.Printf("Thread %2d | Request %3d/%d | build error: %v", threadID, reqNum, requestsPerThread, err)
-			atomic.AddUint64(&failureCount, 1)
-			continue
-		}
-		if authToken != "" {
-			req.Header.Set("Authorization", "Bearer "+authToken)
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		start := time.Now()
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Thread %2d | Request %3d/%d | send error: %v", threadID, reqNum, requestsPerThread, err)
-			atomic.AddUint64(&failureCount, 1)
-			continue
-		}
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
-
-		dur := time.Since(start)
-		ns := uint64(dur.Nanoseconds())
-		atomic.AddUint64(&totalDurationNs, ns)
-		updateMin(ns)
-		updateMax(ns)
-
-		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-			atomic.AddUint64(&successCount, 1)
-		} else {
-			atomic.AddUint64(&failureCount, 1)
+	if cfg.OutputFormat == "json" {
+		if err := writeJSONReport(report); err != nil {
+			log.Fatalf("Cannot write JSON report: %v", err)
 		}
+	} else if !cfg.NoBanner {
+		fmt.Println()
+	}
 
-		log.Printf("Thread %2d | Request %3d/%d | Status: %s", threadID, reqNum, requestsPerThread, resp.Status)
+	if !passed {
+		os.Exit(1)
 	}
 }
 
-func main() {
-	payload, err := os.ReadFile("payload.json")
+// runAB compares TARGET_URL_A against TARGET_URL_B and exits like main.
+func runAB(ctx context.Context, cfg loadtest.Config) {
+	report, err := loadtest.RunAB(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Cannot read payload.json: %v", err)
+		log.Fatalf("Cannot start load test: %v", err)
 	}
-
-	runtime.GOMAXPROCS(runtime.NumCPU())
-
-	totalRequests := numThreads * requestsPerThread
-	log.Printf("🚀 Starting load test (Go)...")
-	log.Printf("Threads: %d, Requests/Thread: %d, Total: %d", numThreads, requestsPerThread, totalRequests)
-	log.Printf("Target URL: %s", targetURL)
-	if authToken == "" {
-		log.Println("Auth Token: Not set")
-	} else {
-		log.Println("Auth Token: Set (hidden)")
+	if !cfg.NoBanner || cfg.OutputFormat != "json" {
+		loadtest.LogABReport(cfg, report)
 	}
-	log.Printf("----------------------------------------------------------------------")
-
-	start := time.Now()
+	passed := loadtest.ABThresholdsPassed(cfg, report)
 
-	var wg sync.WaitGroup
-	wg.Add(numThreads)
-
-	for i := range numThreads {
-		go worker(i+1, payload, &wg)
-	}
-
-	wg.Wait()
-
-	duration := time.Since(start)
-	durationMs := float64(duration.Milliseconds())
-	var rps float64
-	if duration.Seconds() > 0 {
-		rps = float64(totalRequests) / duration.Seconds()
-	}
-
-	avgMs := float64(0)
-	if totalRequests > 0 {
-		avgMs = float64(totalDurationNs) / float64(totalRequests) / 1_000_000.0
+	if cfg.OutputFormat == "json" {
+		if err := writeJSONReport(report); err != nil {
+			log.Fatalf("Cannot write JSON report: %v", err)
+		}
+	} else if !cfg.NoBanner {
+		fmt.Println()
 	}
 
-	minFinal := atomic.LoadUint64(&minDurationNs)
-	minMs := float64(0)
-	if minFinal != ^uint64(0) { // check if it was updated from initial max value
-		minMs = float64(minFinal) / 1_000_000.0
+	if !passed {
+		os.Exit(1)
 	}
+}
 
-	maxMs := float64(atomic.LoadUint64(&maxDurationNs)) / 1_000_000.0
-
-	log.Printf("----------------------------------------------------------------------")
-	log.Printf("✅ Test completed in %.2f ms", durationMs)
-	log.Printf("Total requests: %d", totalRequests)
-	log.Printf("  -> Success ✅: %d", atomic.LoadUint64(&successCount))
-	log.Printf("  -> Failure ❌: %d", atomic.LoadUint64(&failureCount))
-	log.Printf("Performance: ~%.2f requests/second (RPS)", rps)
-	log.Printf("Response times (ms): min %.2f | avg %.2f | max %.2f", minMs, avgMs, maxMs)
-
-	fmt.Println()
+// writeJSONReport emits the report as a single JSON object on stdout.
+func writeJSONReport(r any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
 }